@@ -0,0 +1,206 @@
+// Copyright 2016 zxfonline@sina.com. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package golog
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+//LoggerInfo 记录器配置信息
+type LoggerInfo struct {
+	Name      string   `json:"name"`
+	Level     string   `json:"level"`
+	Flags     int      `json:"flags"`
+	Outputs   []string `json:"outputs"`
+	Formatter string   `json:"formatter"`
+	Trace     bool     `json:"trace"`
+	Async     bool     `json:"async"`
+	Sample    string   `json:"sample,omitempty"`
+	Dedup     string   `json:"dedup,omitempty"`
+	//临时等级的到期时间
+	LevelExpire *time.Time `json:"level_expire,omitempty"`
+}
+
+func newLoggerInfo(name string, s Settings) LoggerInfo {
+	info := LoggerInfo{
+		Name:      name,
+		Level:     levelNames[s.Level],
+		Flags:     s.Flag,
+		Outputs:   s.Outputs(),
+		Formatter: formatterName(s.Formatter),
+		Trace:     s.Trace,
+		Async:     s.Flag&Lasync != 0,
+		Sample:    s.Sample.String(),
+	}
+	if s.Dedup > 0 {
+		info.Dedup = s.Dedup.String()
+	}
+	return info
+}
+
+var (
+	adminMu sync.Mutex
+	//临时修改后恢复配置的定时器,key 为记录器名称,全局配置为空
+	adminTimers = make(map[string]*time.Timer)
+)
+
+//AdminHandler 返回运行时查看、修改记录器配置的 http.Handler
+//GET 返回全局配置及全部记录器的配置(JSON)
+//PUT/POST 参数 name=记录器名称,为空时修改全局配置(只影响之后创建的记录器);
+//args=输出参数,多个使用","分割 eg:DEBUG,CONSOLE,不允许 DAILY_ROLLING_FILE(路径);ttl=到期后恢复为配置文件中的配置 eg:10m;
+//level=等级,与 ttl 一起使用且未设置 args 时等同于 SetLevelFor
+//eg: http.Handle("/debug/golog", golog.AdminHandler())
+//eg: curl -X PUT "http://127.0.0.1:8080/debug/golog?name=test1&args=DEBUG&ttl=10m"
+//eg: curl -X PUT "http://127.0.0.1:8080/debug/golog?name=game&level=DEBUG&ttl=10m"
+func AdminHandler() http.Handler {
+	return http.HandlerFunc(serveAdmin)
+}
+
+func serveAdmin(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case "GET", "HEAD":
+	case "PUT", "POST":
+		if code, err := adminUpdate(r); err != nil {
+			http.Error(w, err.Error(), code)
+			return
+		}
+	default:
+		w.Header().Set("Allow", "GET, PUT, POST")
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json; charset=utf-8")
+	json.NewEncoder(w).Encode(adminInfo())
+}
+
+//adminInfo 返回全局配置及全部记录器的配置
+func adminInfo() interface{} {
+	mu.Lock()
+	root := newLoggerInfo("", rootSettings())
+	loggers := make([]*Logger, 0, len(logMap))
+	for _, logger := range logMap {
+		loggers = append(loggers, logger)
+	}
+	mu.Unlock()
+	infos := make([]LoggerInfo, 0, len(loggers))
+	for _, logger := range loggers {
+		info := newLoggerInfo(logger.Name, logger.settings())
+		if expire, ok := TempLevelExpire(logger.Name); ok {
+			info.LevelExpire = &expire
+		}
+		infos = append(infos, info)
+	}
+	sort.Slice(infos, func(i, j int) bool { return infos[i].Name < infos[j].Name })
+	return struct {
+		Root    LoggerInfo   `json:"root"`
+		Loggers []LoggerInfo `json:"loggers"`
+	}{root, infos}
+}
+
+func adminUpdate(r *http.Request) (int, error) {
+	name := strings.TrimSpace(r.FormValue("name"))
+	var args []string
+	for _, arg := range strings.Split(r.FormValue("args"), ",") {
+		if arg = strings.TrimSpace(arg); arg != "" {
+			if !validArg(arg) {
+				return http.StatusBadRequest, fmt.Errorf("invalid args %q", arg)
+			}
+			args = append(args, arg)
+		}
+	}
+	var ttl time.Duration
+	if v := r.FormValue("ttl"); v != "" {
+		var err error
+		if ttl, err = time.ParseDuration(v); err != nil || ttl <= 0 {
+			return http.StatusBadRequest, fmt.Errorf("invalid ttl %q", v)
+		}
+	}
+	if v := r.FormValue("level"); v != "" {
+		level, ok := parseLevel(v)
+		if !ok {
+			return http.StatusBadRequest, fmt.Errorf("invalid level %q", v)
+		}
+		if name != "" && ttl > 0 && len(args) == 0 {
+			//只修改等级时使用临时等级,重新加载配置后继续生效直到到期
+			SetLevelFor(name, level, ttl)
+			return http.StatusOK, nil
+		}
+		args = append(args, levelNames[level])
+	}
+	if len(args) == 0 {
+		return http.StatusBadRequest, fmt.Errorf("args or level required")
+	}
+	if name != "" {
+		if _, ok := Lookup(name); !ok {
+			return http.StatusNotFound, fmt.Errorf("logger %q not found", name)
+		}
+	}
+	for _, arg := range args {
+		if name == "" {
+			SetGlobalOutPut(arg)
+		} else {
+			SetOutPutByName(name, arg)
+		}
+	}
+	Infof("log4go admin update logger[%s] args:%v ttl:%v", name, args, ttl)
+	adminMu.Lock()
+	defer adminMu.Unlock()
+	if t, ok := adminTimers[name]; ok {
+		t.Stop()
+		delete(adminTimers, name)
+	}
+	if ttl > 0 {
+		var t *time.Timer
+		t = time.AfterFunc(ttl, func() {
+			adminMu.Lock()
+			if adminTimers[name] != t {
+				adminMu.Unlock()
+				return
+			}
+			delete(adminTimers, name)
+			adminMu.Unlock()
+			if name == "" {
+				ResetGlobalOutPut()
+			} else {
+				ResetOutPutByName(name)
+			}
+			Infof("log4go admin logger[%s] ttl expired,reset to config", name)
+		})
+		adminTimers[name] = t
+	}
+	return http.StatusOK, nil
+}
+
+//validArg 是否为可通过 http 设置的输出参数
+func validArg(arg string) bool {
+	arg, param := parseFileArg(arg)
+	switch arg {
+	case "CONSOLE", "ASYNC", "DUMPSTACK", "DEBUG", "INFO", "WARN", "ERROR", "FATAL":
+		return param == ""
+	case "DAILY_ROLLING_FILE":
+		//不允许通过 http 指定文件路径,只能使用配置文件中配置的日志文件
+		return param == ""
+	case "SAMPLE":
+		var c SampleConfig
+		return c.parseSample(param) == nil
+	case "RATE":
+		var c SampleConfig
+		return c.parseRate(param) == nil
+	case "DEDUP":
+		_, err := parseDedup(param)
+		return err == nil
+	}
+	if _, ok := GetFormatter(arg); ok {
+		return true
+	}
+	_, ok := GetAppender(arg)
+	return ok
+}
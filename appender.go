@@ -0,0 +1,238 @@
+// Copyright 2016 zxfonline@sina.com. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package golog
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"sync"
+
+	"github.com/zxfonline/config"
+)
+
+//Appender 日志输出目标,一个记录器可同时输出到多个目标
+type Appender interface {
+	//Name 输出目标名称,配置文件中按名称(不区分大小写)引用
+	Name() string
+	//Append 输出一条记录,由输出目标自行过滤等级并格式化
+	Append(r *Record) error
+	//Close 关闭输出目标
+	Close() error
+}
+
+//WriterAppender 将记录格式化后写入 io.Writer 的输出目标
+type WriterAppender struct {
+	name      string
+	w         io.Writer
+	level     LogLevel
+	formatter Formatter
+	mu        sync.Mutex
+	buf       []byte
+}
+
+//NewWriterAppender 构建输出目标,等级低于 level 的记录不输出(操作日志除外),formatter 为空时使用 DefaultFormatter
+func NewWriterAppender(name string, w io.Writer, level LogLevel, formatter Formatter) *WriterAppender {
+	return &WriterAppender{name: name, w: w, level: level, formatter: formatter}
+}
+
+func (a *WriterAppender) Name() string {
+	return a.name
+}
+
+//Level 返回输出等级
+func (a *WriterAppender) Level() LogLevel {
+	return a.level
+}
+
+//Writer 返回底层输出流
+func (a *WriterAppender) Writer() io.Writer {
+	return a.w
+}
+
+func (a *WriterAppender) Append(r *Record) (err error) {
+	if r.Level < a.level {
+		return nil
+	}
+	formatter := a.formatter
+	if formatter == nil {
+		formatter = DefaultFormatter
+	}
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	a.buf = formatter.Format(a.buf[:0], r)
+	_, err = writeLevel(a.w, r.Level, a.buf)
+	return
+}
+
+//Flush 刷新底层输出流的缓存
+func (a *WriterAppender) Flush() error {
+	if f, ok := a.w.(flusher); ok {
+		return f.Flush()
+	}
+	return nil
+}
+
+//Close 关闭底层输出流,标准输出、标准错误不会被关闭
+func (a *WriterAppender) Close() error {
+	if a.w == os.Stdout || a.w == os.Stderr {
+		return nil
+	}
+	if c, ok := a.w.(io.Closer); ok {
+		return c.Close()
+	}
+	return nil
+}
+
+var (
+	appenderMu sync.RWMutex
+	appenders  = make(map[string]Appender)
+)
+
+//RegisterAppender 注册输出目标,注册后可在配置文件 [log4go]、[logger] 中按名称引用,同名的输出目标会被替换
+func RegisterAppender(a Appender) {
+	appenderMu.Lock()
+	defer appenderMu.Unlock()
+	key := strings.ToUpper(a.Name())
+	appenders[key] = a
+	delete(appenderCfgs, key)
+}
+
+//GetAppender 根据名称获取输出目标
+func GetAppender(name string) (Appender, bool) {
+	appenderMu.RLock()
+	defer appenderMu.RUnlock()
+	a, ok := appenders[strings.ToUpper(name)]
+	return a, ok
+}
+
+//addAppender 添加输出目标,返回新的切片不修改原有切片
+func addAppender(as []Appender, a Appender) []Appender {
+	for _, o := range as {
+		if o == a {
+			return as
+		}
+	}
+	return append(as[:len(as):len(as)], a)
+}
+
+//appendTo 将记录输出到各个输出目标
+func appendTo(as []Appender, r *Record) {
+	for _, a := range as {
+		a.Append(r)
+		//	if err := a.Append(r); err != nil {
+		//		fmt.Printf("append log err:%v\n", err)
+		//	}
+	}
+}
+
+//closeAppenders 关闭并注销所有注册的输出目标
+func closeAppenders() {
+	appenderMu.Lock()
+	defer appenderMu.Unlock()
+	for key, a := range appenders {
+		a.Close()
+		delete(appenders, key)
+		delete(appenderCfgs, key)
+	}
+}
+
+//appenderConfig 配置文件中的输出目标配置,配置未变化时重新加载不替换输出目标
+type appenderConfig struct {
+	typ       string
+	level     LogLevel
+	formatter Formatter
+	rc        RotateConfig
+}
+
+func (c appenderConfig) equal(o appenderConfig) bool {
+	return c.typ == o.typ && c.level == o.level && c.rc == o.rc && sameValue(c.formatter, o.formatter)
+}
+
+//配置文件中构建的输出目标的配置,key 为大写的名称
+var appenderCfgs = make(map[string]appenderConfig)
+
+//initAppender 解析配置文件中的输出目标 [appender.名称],替换配置发生变化的同名输出目标,返回被替换的旧输出目标
+//eg: [appender.game_file]type=daily_file filePath=./log/game.log level=WARN formatter=JSON
+//eg: [appender.stderr]type=stderr level=ERROR
+func initAppender(cfg *config.Config) (olds []Appender) {
+	for _, section := range cfg.Sections() {
+		if !strings.HasPrefix(section, "appender.") {
+			continue
+		}
+		name := strings.TrimPrefix(section, "appender.")
+		c, err := parseAppenderConfig(cfg, section)
+		if err != nil {
+			Warnf("appender[%s] err:%v", name, err)
+			continue
+		}
+		key := strings.ToUpper(name)
+		old, ok := GetAppender(name)
+		appenderMu.RLock()
+		oc, cfgOk := appenderCfgs[key]
+		appenderMu.RUnlock()
+		if ok && cfgOk && oc.equal(c) {
+			continue
+		}
+		a, err := c.newAppender(name)
+		if err != nil {
+			Warnf("appender[%s] err:%v", name, err)
+			continue
+		}
+		Infof("appender[%s] setting:%s", name, section)
+		if ok {
+			olds = append(olds, old)
+		}
+		RegisterAppender(a)
+		appenderMu.Lock()
+		appenderCfgs[key] = c
+		appenderMu.Unlock()
+	}
+	return
+}
+
+func parseAppenderConfig(cfg *config.Config, section string) (c appenderConfig, err error) {
+	c.level = LEVEL_DEBUG
+	if v, err := cfg.String(section, "level"); err == nil {
+		lv, ok := parseLevel(v)
+		if !ok {
+			return c, fmt.Errorf("invalid level %q", v)
+		}
+		c.level = lv
+	}
+	if v, err := cfg.String(section, "formatter"); err == nil && v != "" {
+		f, ok := GetFormatter(v)
+		if !ok {
+			return c, fmt.Errorf("formatter %q not found", v)
+		}
+		c.formatter = f
+	}
+	typ, _ := cfg.String(section, "type")
+	c.typ = strings.ToLower(strings.TrimSpace(typ))
+	switch c.typ {
+	case "console", "stdout", "stderr":
+	case "", "daily_file", "daily_rolling_file":
+		c.rc, err = parseRotateConfig(cfg, section, RotateConfig{CacheSize: LOG_WRITE_CACHE_SIZE})
+	default:
+		err = fmt.Errorf("unknown appender type %q", typ)
+	}
+	return
+}
+
+func (c appenderConfig) newAppender(name string) (Appender, error) {
+	switch c.typ {
+	case "console", "stdout":
+		return NewWriterAppender(name, os.Stdout, c.level, c.formatter), nil
+	case "stderr":
+		return NewWriterAppender(name, os.Stderr, c.level, c.formatter), nil
+	default:
+		w, err := NewRotate(c.rc)
+		if err != nil {
+			return nil, err
+		}
+		return NewWriterAppender(name, w, c.level, c.formatter), nil
+	}
+}
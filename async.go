@@ -0,0 +1,222 @@
+// Copyright 2016 zxfonline@sina.com. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package golog
+
+import (
+	"fmt"
+	"io"
+	"strings"
+	"sync"
+	"sync/atomic"
+)
+
+//AsyncOverflow 异步队列已满时的处理策略
+type AsyncOverflow int
+
+const (
+	OverflowBlock      AsyncOverflow = iota //阻塞等待队列空闲
+	OverflowDropNewest                      //丢弃当前记录
+	OverflowDropOldest                      //丢弃队列中最旧的记录
+	OverflowDropLevel                       //丢弃低于指定等级的当前记录,其余阻塞等待
+)
+
+var overflowNames = [...]string{"block", "drop_newest", "drop_oldest", "drop_level"}
+
+func (o AsyncOverflow) String() string {
+	if o < 0 || int(o) >= len(overflowNames) {
+		return fmt.Sprintf("AsyncOverflow(%d)", int(o))
+	}
+	return overflowNames[o]
+}
+
+//ParseAsyncOverflow 解析队列已满处理策略 block、drop_newest、drop_oldest、drop_level
+func ParseAsyncOverflow(s string) (AsyncOverflow, error) {
+	s = strings.ToLower(strings.TrimSpace(s))
+	for i, name := range overflowNames {
+		if name == s {
+			return AsyncOverflow(i), nil
+		}
+	}
+	return OverflowBlock, fmt.Errorf("invalid async overflow %q", s)
+}
+
+var (
+	//异步输出队列默认长度
+	ASYNC_QUEUE_SIZE = 8192
+
+	asyncMu sync.RWMutex
+	aw      *asyncWriter
+	//异步队列配置
+	asyncSize      = ASYNC_QUEUE_SIZE
+	asyncOverflow  = OverflowBlock
+	asyncDropLevel = LEVEL_WARN
+	asyncDropped   uint64
+)
+
+//asyncRecord 异步队列中已格式化的日志记录
+type asyncRecord struct {
+	level LogLevel
+	flag  int
+	out   io.Writer
+	buf   []byte
+	as    []Appender
+	rec   Record
+	done  chan struct{} //不为空时表示等待队列写完的标记
+}
+
+//asyncWriter 异步写入器,由单个协程按顺序写出队列中的记录
+type asyncWriter struct {
+	queue     chan *asyncRecord
+	marks     chan *asyncRecord //从队列中取出的等待标记,交由写入协程处理
+	overflow  AsyncOverflow
+	dropLevel LogLevel
+	exit      chan struct{}
+}
+
+func newAsyncWriter(size int, overflow AsyncOverflow, dropLevel LogLevel) *asyncWriter {
+	if size <= 0 {
+		size = ASYNC_QUEUE_SIZE
+	}
+	w := &asyncWriter{
+		queue:     make(chan *asyncRecord, size),
+		marks:     make(chan *asyncRecord),
+		overflow:  overflow,
+		dropLevel: dropLevel,
+		exit:      make(chan struct{}),
+	}
+	go w.run()
+	return w
+}
+
+func (w *asyncWriter) run() {
+	defer close(w.exit)
+	for {
+		select {
+		case r, ok := <-w.queue:
+			if !ok {
+				return
+			}
+			if r.done != nil {
+				close(r.done)
+				continue
+			}
+			writeTo(r.level, r.flag, r.out, r.buf, r.as, &r.rec)
+		case r := <-w.marks:
+			//标记之前的记录均已取出并写完
+			close(r.done)
+		}
+	}
+}
+
+func (w *asyncWriter) put(r *asyncRecord) {
+	switch w.overflow {
+	case OverflowDropNewest:
+		select {
+		case w.queue <- r:
+		default:
+			atomic.AddUint64(&asyncDropped, 1)
+		}
+	case OverflowDropOldest:
+		for {
+			select {
+			case w.queue <- r:
+				return
+			default:
+			}
+			select {
+			case old := <-w.queue:
+				if old.done != nil {
+					//等待标记不能丢弃,交由写入协程在写完当前记录后通知
+					w.marks <- old
+					continue
+				}
+				atomic.AddUint64(&asyncDropped, 1)
+			default:
+			}
+		}
+	case OverflowDropLevel:
+		if r.level < w.dropLevel {
+			select {
+			case w.queue <- r:
+			default:
+				atomic.AddUint64(&asyncDropped, 1)
+			}
+			return
+		}
+		w.queue <- r
+	default:
+		w.queue <- r
+	}
+}
+
+//asyncWrite 将已格式化的记录放入异步队列,首次使用时启动写入协程
+func asyncWrite(level LogLevel, flag int, out io.Writer, buf []byte, as []Appender, rec *Record) {
+	asyncMu.RLock()
+	if aw == nil {
+		asyncMu.RUnlock()
+		asyncMu.Lock()
+		if aw == nil {
+			aw = newAsyncWriter(asyncSize, asyncOverflow, asyncDropLevel)
+		}
+		asyncMu.Unlock()
+		asyncMu.RLock()
+	}
+	defer asyncMu.RUnlock()
+	if aw == nil {
+		//并发关闭时直接写出
+		writeTo(level, flag, out, buf, as, rec)
+		return
+	}
+	r := &asyncRecord{level: level, flag: flag, out: out, buf: append([]byte(nil), buf...), as: as}
+	if len(as) > 0 || level == LEVEL_LOG {
+		r.rec = *rec
+	}
+	aw.put(r)
+}
+
+//SetAsync 设置异步输出的队列长度、队列已满时的处理策略以及 OverflowDropLevel 策略下丢弃的等级(低于该等级的记录被丢弃),
+//已有队列中的记录会先写完再切换
+func SetAsync(size int, overflow AsyncOverflow, dropLevel LogLevel) {
+	asyncMu.Lock()
+	defer asyncMu.Unlock()
+	asyncSize, asyncOverflow, asyncDropLevel = size, overflow, dropLevel
+	if aw != nil {
+		aw.close()
+		aw = newAsyncWriter(size, overflow, dropLevel)
+	}
+}
+
+//close 关闭队列并等待写完
+func (w *asyncWriter) close() {
+	close(w.queue)
+	<-w.exit
+}
+
+//flushAsync 等待异步队列中已有的记录全部写出
+func flushAsync() {
+	asyncMu.RLock()
+	defer asyncMu.RUnlock()
+	if aw == nil {
+		return
+	}
+	done := make(chan struct{})
+	aw.queue <- &asyncRecord{done: done}
+	<-done
+}
+
+//closeAsync 关闭异步队列,等待队列中的记录全部写出
+func closeAsync() {
+	asyncMu.Lock()
+	defer asyncMu.Unlock()
+	if aw != nil {
+		aw.close()
+		aw = nil
+	}
+}
+
+//AsyncDropped 返回异步队列已满时被丢弃的记录数
+func AsyncDropped() uint64 {
+	return atomic.LoadUint64(&asyncDropped)
+}
@@ -0,0 +1,310 @@
+// Copyright 2016 zxfonline@sina.com. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package golog
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"runtime"
+	"strings"
+	"sync"
+	"time"
+)
+
+//LogWriter 将写入的内容按行输出为日志记录的 io.Writer,
+//行首带有等级前缀时使用该等级输出 eg:[ERROR] xxx、WARN: xxx,否则使用默认等级
+type LogWriter struct {
+	l     *Logger
+	level LogLevel
+	mu    sync.Mutex
+	buf   []byte
+}
+
+//Writer 返回按行输出到记录器的 io.Writer,level 为行首未带等级前缀时的默认等级
+//eg: cmd.Stderr = golog.Get("cmd").Writer(golog.LEVEL_WARN)
+func (l *Logger) Writer(level LogLevel) *LogWriter {
+	return &LogWriter{l: l, level: level}
+}
+
+func (w *LogWriter) Write(p []byte) (int, error) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	w.buf = append(w.buf, p...)
+	for {
+		i := bytes.IndexByte(w.buf, '\n')
+		if i < 0 {
+			break
+		}
+		w.writeLine(string(w.buf[:i]))
+		w.buf = w.buf[i+1:]
+	}
+	if len(w.buf) == 0 {
+		w.buf = nil
+	}
+	return len(p), nil
+}
+
+//Flush 输出缓存中未换行的内容
+func (w *LogWriter) Flush() {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if len(w.buf) > 0 {
+		w.writeLine(string(w.buf))
+		w.buf = nil
+	}
+}
+
+func (w *LogWriter) writeLine(line string) {
+	line = strings.TrimRight(line, "\r")
+	level, msg, ok := parseLevelPrefix(line)
+	if !ok {
+		level, msg = w.level, line
+	}
+	if level != LEVEL_LOG && level < w.l.level() || w.l.sampledAt(level, callerSearch, 0, "") {
+		return
+	}
+	w.l.outputAt(time.Now(), level, callerSearch, 0, msg, w.l.fields)
+}
+
+//parseLevelPrefix 解析行首的等级前缀 eg:[ERROR] xxx、[WARN ] xxx、ERROR: xxx、WARNING xxx
+func parseLevelPrefix(line string) (LogLevel, string, bool) {
+	s := strings.TrimLeft(line, " \t")
+	var token string
+	if strings.HasPrefix(s, "[") {
+		i := strings.IndexByte(s, ']')
+		if i < 0 {
+			return 0, line, false
+		}
+		token, s = strings.TrimSpace(s[1:i]), s[i+1:]
+	} else {
+		i := strings.IndexAny(s, ": ")
+		if i < 0 {
+			return 0, line, false
+		}
+		token, s = s[:i], s[i+1:]
+	}
+	var level LogLevel
+	switch token {
+	case "DEBUG":
+		level = LEVEL_DEBUG
+	case "INFO":
+		level = LEVEL_INFO
+	case "WARN", "WARNING":
+		level = LEVEL_WARN
+	case "ERROR":
+		level = LEVEL_ERROR
+	case "FATAL":
+		level = LEVEL_FATAL
+	default:
+		return 0, line, false
+	}
+	return level, strings.TrimLeft(s, ": \t"), true
+}
+
+var bridgeFile = func() string {
+	_, file, _, _ := runtime.Caller(0)
+	return file
+}()
+
+//outputAt 的 calldepth 参数,表示从调用栈中查找调用位置
+const callerSearch = -1
+
+//searchCaller 返回调用位置,跳过标准库 log、fmt 以及本文件中的调用
+func searchCaller() (file string, line int, ok bool) {
+	f := searchFrame(2)
+	return f.File, f.Line, f.File != ""
+}
+
+//searchFrame 从调用栈中查找调用位置,skip 为调用方之上需跳过的 golog 内部调用层数,
+//之后跳过标准库 log、fmt 以及本文件中的调用
+func searchFrame(skip int) runtime.Frame {
+	var pcs [32]uintptr
+	n := runtime.Callers(skip+2, pcs[:])
+	frames := runtime.CallersFrames(pcs[:n])
+	for {
+		f, more := frames.Next()
+		if f.File != bridgeFile && !strings.HasPrefix(f.Function, "log.") && !strings.HasPrefix(f.Function, "fmt.") {
+			return f
+		}
+		if !more {
+			return runtime.Frame{}
+		}
+	}
+}
+
+//StdLogger 返回输出到记录器的标准库 *log.Logger,level 为行首未带等级前缀时的默认等级
+//eg: http.Server{ErrorLog: golog.Get("http").StdLogger(golog.LEVEL_ERROR)}
+func (l *Logger) StdLogger(level LogLevel) *log.Logger {
+	return log.New(l.Writer(level), "", 0)
+}
+
+var (
+	stdLogWriter *LogWriter
+	//重定向前标准库 log 包的输出配置
+	stdLogOut    io.Writer
+	stdLogPrefix string
+	stdLogFlags  int
+)
+
+//RedirectStdLog 将标准库 log 包的默认输出重定向到记录器,level 为行首未带等级前缀时的默认等级,
+//未调用时加载配置且配置了日志文件([daily_file])后默认重定向到 Trace 记录器的 INFO 等级,Close 时恢复原有的输出配置
+func RedirectStdLog(l *Logger, level LogLevel) {
+	mu.Lock()
+	defer mu.Unlock()
+	redirectStdLog(l, level)
+}
+
+func redirectStdLog(l *Logger, level LogLevel) {
+	if stdLogWriter == nil {
+		stdLogOut, stdLogPrefix, stdLogFlags = log.Writer(), log.Prefix(), log.Flags()
+	} else {
+		stdLogWriter.Flush()
+	}
+	stdLogWriter = l.Writer(level)
+	log.SetFlags(0)
+	log.SetPrefix("")
+	log.SetOutput(stdLogWriter)
+}
+
+//resetStdLog 恢复标准库 log 包重定向前的输出配置
+func resetStdLog() {
+	if stdLogWriter != nil {
+		stdLogWriter.Flush()
+		stdLogWriter = nil
+		log.SetOutput(stdLogOut)
+		log.SetPrefix(stdLogPrefix)
+		log.SetFlags(stdLogFlags)
+		stdLogOut = nil
+	}
+}
+
+//PrintfLogger 只提供 Printf 方法的日志接口适配 eg:retryablehttp.Logger
+type PrintfLogger struct {
+	w *LogWriter
+}
+
+//PrintfLogger 返回 Printf 风格的日志接口适配,消息行首带有等级前缀时使用该等级输出
+func (l *Logger) PrintfLogger(level LogLevel) *PrintfLogger {
+	return &PrintfLogger{w: l.Writer(level)}
+}
+
+func (p *PrintfLogger) Printf(format string, v ...interface{}) {
+	p.w.Write([]byte(strings.TrimRight(fmt.Sprintf(format, v...), "\n") + "\n"))
+}
+
+//LeveledLogger 携带键值对参数的分等级日志接口适配 eg:retryablehttp.LeveledLogger
+type LeveledLogger struct {
+	l *Logger
+}
+
+//LeveledLogger 返回携带键值对参数的分等级日志接口适配
+func (l *Logger) LeveledLogger() *LeveledLogger {
+	return &LeveledLogger{l: l}
+}
+
+func (p *LeveledLogger) Debug(msg string, kv ...interface{}) {
+	p.l.logw(LEVEL_DEBUG, 3, msg, kv)
+}
+
+func (p *LeveledLogger) Info(msg string, kv ...interface{}) {
+	p.l.logw(LEVEL_INFO, 3, msg, kv)
+}
+
+func (p *LeveledLogger) Warn(msg string, kv ...interface{}) {
+	p.l.logw(LEVEL_WARN, 3, msg, kv)
+}
+
+func (p *LeveledLogger) Error(msg string, kv ...interface{}) {
+	p.l.logw(LEVEL_ERROR, 3, msg, kv)
+}
+
+//print 非格式化输出,ln 为 true 时按 fmt.Sprintln 否则按 fmt.Sprint 拼接参数,calldepth 与 output 相同
+func (l *Logger) print(level LogLevel, calldepth int, ln bool, v []interface{}) {
+	if (level == LEVEL_LOG || level >= l.level()) && !l.sampled(level, calldepth, "") {
+		var s string
+		if ln {
+			s = fmt.Sprintln(v...)
+		} else {
+			s = fmt.Sprint(v...)
+		}
+		l.output(level, calldepth, s, l.fields)
+	}
+}
+
+//GrpcLogger grpclog.LoggerV2 接口适配,Fatal 系列方法输出后刷新日志并退出程序
+//eg: grpclog.SetLoggerV2(golog.NewGrpcLogger(golog.Get("grpc"), 0))
+type GrpcLogger struct {
+	l         *Logger
+	verbosity int
+}
+
+//NewGrpcLogger 构建 grpclog.LoggerV2 接口适配,verbosity 为 V(l) 判断的详细级别
+func NewGrpcLogger(l *Logger, verbosity int) *GrpcLogger {
+	return &GrpcLogger{l: l, verbosity: verbosity}
+}
+
+func (g *GrpcLogger) Info(args ...interface{}) {
+	g.l.print(LEVEL_INFO, 3, false, args)
+}
+
+func (g *GrpcLogger) Infoln(args ...interface{}) {
+	g.l.print(LEVEL_INFO, 3, true, args)
+}
+
+func (g *GrpcLogger) Infof(format string, args ...interface{}) {
+	g.l.log(LEVEL_INFO, 3, format, args...)
+}
+
+func (g *GrpcLogger) Warning(args ...interface{}) {
+	g.l.print(LEVEL_WARN, 3, false, args)
+}
+
+func (g *GrpcLogger) Warningln(args ...interface{}) {
+	g.l.print(LEVEL_WARN, 3, true, args)
+}
+
+func (g *GrpcLogger) Warningf(format string, args ...interface{}) {
+	g.l.log(LEVEL_WARN, 3, format, args...)
+}
+
+func (g *GrpcLogger) Error(args ...interface{}) {
+	g.l.print(LEVEL_ERROR, 3, false, args)
+}
+
+func (g *GrpcLogger) Errorln(args ...interface{}) {
+	g.l.print(LEVEL_ERROR, 3, true, args)
+}
+
+func (g *GrpcLogger) Errorf(format string, args ...interface{}) {
+	g.l.log(LEVEL_ERROR, 3, format, args...)
+}
+
+func (g *GrpcLogger) Fatal(args ...interface{}) {
+	g.l.print(LEVEL_FATAL, 3, false, args)
+	g.exit()
+}
+
+func (g *GrpcLogger) Fatalln(args ...interface{}) {
+	g.l.print(LEVEL_FATAL, 3, true, args)
+	g.exit()
+}
+
+func (g *GrpcLogger) Fatalf(format string, args ...interface{}) {
+	g.l.log(LEVEL_FATAL, 3, format, args...)
+	g.exit()
+}
+
+func (g *GrpcLogger) exit() {
+	Flush()
+	os.Exit(1)
+}
+
+//V 详细级别不超过 verbosity 时返回 true
+func (g *GrpcLogger) V(l int) bool {
+	return l <= g.verbosity
+}
@@ -0,0 +1,100 @@
+// Copyright 2016 zxfonline@sina.com. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package golog
+
+import (
+	"context"
+	"fmt"
+)
+
+type fieldsKey struct{}
+
+//NewContext 返回携带结构化字段的 context,字段追加在上游 context 已有的字段之后,
+//使用该 context 的 XxxCtx 方法输出的记录都会携带这些字段
+//eg: ctx = golog.NewContext(ctx, "request_id", reqID, "player_id", pid)
+func NewContext(ctx context.Context, kv ...interface{}) context.Context {
+	return context.WithValue(ctx, fieldsKey{}, joinFields(FromContext(ctx), toFields(kv)))
+}
+
+//FromContext 返回 context 携带的结构化字段
+func FromContext(ctx context.Context) []Field {
+	if ctx == nil {
+		return nil
+	}
+	fields, _ := ctx.Value(fieldsKey{}).([]Field)
+	return fields
+}
+
+func (l *Logger) logCtx(level LogLevel, calldepth int, ctx context.Context, format string, v []interface{}) {
+	if (level == LEVEL_LOG || level >= l.level()) && !l.sampled(level, calldepth, format) {
+		var s string
+		if format == "" {
+			s = fmt.Sprintln(v...)
+		} else {
+			s = fmt.Sprintf(format, v...)
+		}
+		l.output(level, calldepth, s, joinFields(l.fields, FromContext(ctx)))
+	}
+}
+
+//LogCtx 携带 context 中结构化字段的操作日志输出
+func (l *Logger) LogCtx(ctx context.Context, format string, v ...interface{}) {
+	l.logCtx(LEVEL_LOG, 3, ctx, format, v)
+}
+
+//DebugCtx 携带 context 中结构化字段的调试消息输出
+func (l *Logger) DebugCtx(ctx context.Context, format string, v ...interface{}) {
+	l.logCtx(LEVEL_DEBUG, 3, ctx, format, v)
+}
+
+//InfoCtx 携带 context 中结构化字段的提示消息输出
+func (l *Logger) InfoCtx(ctx context.Context, format string, v ...interface{}) {
+	l.logCtx(LEVEL_INFO, 3, ctx, format, v)
+}
+
+//WarnCtx 携带 context 中结构化字段的警告消息输出
+func (l *Logger) WarnCtx(ctx context.Context, format string, v ...interface{}) {
+	l.logCtx(LEVEL_WARN, 3, ctx, format, v)
+}
+
+//ErrorCtx 携带 context 中结构化字段的错误消息输出
+func (l *Logger) ErrorCtx(ctx context.Context, format string, v ...interface{}) {
+	l.logCtx(LEVEL_ERROR, 3, ctx, format, v)
+}
+
+//FatalCtx 携带 context 中结构化字段的严重错误消息输出
+func (l *Logger) FatalCtx(ctx context.Context, format string, v ...interface{}) {
+	l.logCtx(LEVEL_FATAL, 3, ctx, format, v)
+}
+
+//LogCtx 携带 context 中结构化字段的操作日志输出
+func LogCtx(ctx context.Context, format string, v ...interface{}) {
+	Trace.logCtx(LEVEL_LOG, 3, ctx, format, v)
+}
+
+//DebugCtx 携带 context 中结构化字段的调试消息输出
+func DebugCtx(ctx context.Context, format string, v ...interface{}) {
+	Trace.logCtx(LEVEL_DEBUG, 3, ctx, format, v)
+}
+
+//InfoCtx 携带 context 中结构化字段的提示消息输出
+func InfoCtx(ctx context.Context, format string, v ...interface{}) {
+	Trace.logCtx(LEVEL_INFO, 3, ctx, format, v)
+}
+
+//WarnCtx 携带 context 中结构化字段的警告消息输出
+func WarnCtx(ctx context.Context, format string, v ...interface{}) {
+	Trace.logCtx(LEVEL_WARN, 3, ctx, format, v)
+}
+
+//ErrorCtx 携带 context 中结构化字段的错误消息输出
+func ErrorCtx(ctx context.Context, format string, v ...interface{}) {
+	Trace.logCtx(LEVEL_ERROR, 3, ctx, format, v)
+}
+
+//FatalCtx 携带 context 中结构化字段的严重错误消息输出
+func FatalCtx(ctx context.Context, format string, v ...interface{}) {
+	Trace.logCtx(LEVEL_FATAL, 3, ctx, format, v)
+}
@@ -6,10 +6,16 @@ package golog
 
 import (
 	"bufio"
+	"compress/gzip"
+	"fmt"
 	"io"
+	"io/ioutil"
 	"os"
 	"path"
 	"path/filepath"
+	"regexp"
+	"sort"
+	"strconv"
 	"strings"
 	"sync"
 	"time"
@@ -23,8 +29,49 @@ type DailyRotate struct {
 	f        *os.File
 	w        logWriter
 	mu       sync.Mutex
+	maxSize  int64  //单个文件最大字节数
+	size     int64  //当前文件字节数
+	date     string //当前文件日期后缀
+	index    int    //当前文件在同一周期内的序号
+	period   rotatePeriod
+	retain   RotateConfig
+	cleanMu  sync.Mutex     //保证同一时刻只有一个清理任务
+	wg       sync.WaitGroup //后台任务
+	stop     chan struct{}  //关闭定时刷新
+	closed   bool
 }
 
+//RotateConfig 日志文件滚动配置
+type RotateConfig struct {
+	//Rotate 按时间滚动的周期:daily(默认)、hourly、minutely、weekly、monthly,
+	//或按天对齐的时间间隔 eg:15m、2h,对应文件时间后缀 20061018、20061018_15、20061018_1504、20061016(周一)、200610
+	Rotate string
+	//FilePath 日志文件路径,实际文件名会加上日期后缀 eg:./log/test.log ==> ./log/test_20161018.log
+	FilePath string
+	//CacheSize 写入缓存字节数,<=0 表示不缓存
+	CacheSize int
+	//FlushInterval 开启缓存时定时刷新缓存的间隔,<=0 表示只在缓存写满、滚动及关闭时刷新
+	FlushInterval time.Duration
+	//FlushOnLevel 开启缓存时,通过 WriteLevel 写入等级不低于 FlushLevel 的记录后立即刷新缓存
+	FlushOnLevel bool
+	FlushLevel   LogLevel
+	//MaxSize 单个文件最大字节数,超过后在同一周期内滚动到 test_20161018.1.log、test_20161018.2.log ...,<=0 表示不限制
+	MaxSize int64
+	//MaxDays 保留最近多少天的日志文件,<=0 表示不限制
+	MaxDays int
+	//MaxFiles 最多保留的日志文件个数(包括当前文件),<=0 表示不限制
+	MaxFiles int
+	//MaxTotalSize 日志文件最多占用的总字节数(包括当前文件),<=0 表示不限制
+	MaxTotalSize int64
+	//DisableSymlink 是否禁止在 FilePath 维护指向当前日志文件的符号链接,便于 tail -F 跨周期跟踪
+	DisableSymlink bool
+	//Compress 滚动后旧文件的压缩方式,目前仅支持 gzip,为空表示不压缩
+	Compress string
+}
+
+//CompressGzip gzip 压缩,旧文件压缩为 test_20161018.log.gz
+const CompressGzip = "gzip"
+
 var (
 	//DefaultFileMode 默认的文件权限 0640
 	DefaultFileMode os.FileMode = 0640
@@ -33,6 +80,9 @@ var (
 
 	// linux下需加上O_WRONLY或是O_RDWR
 	DefaultFileFlag int = os.O_APPEND | os.O_CREATE | os.O_RDWR
+
+	//digitReg 时间后缀格式中的数字
+	digitReg = regexp.MustCompile("[0-9]")
 )
 
 type logWriter interface {
@@ -59,7 +109,16 @@ func (f *fileWriter) Write(p []byte) (int, error) {
 
 //构建一个每日写日志文件的写入器
 func NewDailyRotate(pathfile string, cacheSize int) (wc io.WriteCloser, err error) {
-	pathfile = fileutil.TransPath(pathfile)
+	r, err := NewRotate(RotateConfig{FilePath: pathfile, CacheSize: cacheSize})
+	if err != nil {
+		return nil, err
+	}
+	return r, nil
+}
+
+//NewRotate 根据滚动配置构建日志文件写入器
+func NewRotate(c RotateConfig) (r *DailyRotate, err error) {
+	pathfile := fileutil.TransPath(c.FilePath)
 	dir, _ := filepath.Split(pathfile)
 	if _, err = os.Stat(dir); err != nil && !os.IsExist(err) {
 		if !os.IsNotExist(err) {
@@ -72,67 +131,371 @@ func NewDailyRotate(pathfile string, cacheSize int) (wc io.WriteCloser, err erro
 			return
 		}
 	}
-	var f *os.File
-	if f, err = openLogFile(pathfile); err != nil {
-		return
+	r = &DailyRotate{
+		fdir:    pathfile,
+		maxSize: c.MaxSize,
+		retain:  c,
+	}
+	if r.period, err = parseRotatePeriod(c.Rotate); err != nil {
+		return nil, err
 	}
 	t := time.Now()
-	t = t.AddDate(0, 0, 1)
-	year, month, day := t.Date()
-	if cacheSize > 0 {
-		wc = &DailyRotate{
-			fdir:     pathfile,
-			nextDate: time.Date(year, month, day, 0, 0, 0, 0, t.Location()),
-			f:        f,
-			w:        bufio.NewWriterSize(f, cacheSize),
+	r.date = r.period.start(t).Format(r.period.layout)
+	if r.f, r.size, r.index, err = r.openLogFile(r.date, 0); err != nil {
+		return nil, err
+	}
+	r.nextDate = r.period.next(t)
+	if !c.DisableSymlink {
+		if err := updateSymlink(pathfile, r.f.Name()); err != nil {
+			Warnf("log file symlink [%s] err:%v", pathfile, err)
 		}
-	} else {
-		wc = &DailyRotate{
-			fdir:     pathfile,
-			nextDate: time.Date(year, month, day, 0, 0, 0, 0, t.Location()),
-			f:        f,
-			w:        &fileWriter{f},
+	}
+	if c.CacheSize > 0 {
+		r.w = bufio.NewWriterSize(r.f, c.CacheSize)
+		if c.FlushInterval > 0 {
+			r.stop = make(chan struct{})
+			r.wg.Add(1)
+			go r.flushLoop(c.FlushInterval)
 		}
+	} else {
+		r.w = &fileWriter{r.f}
 	}
+	r.afterRotate("")
 	return
 }
 
-func openLogFile(pathfile string) (*os.File, error) {
+//flushLoop 定时刷新缓存
+func (r *DailyRotate) flushLoop(interval time.Duration) {
+	defer r.wg.Done()
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+			r.Flush()
+		case <-r.stop:
+			return
+		}
+	}
+}
+
+//rotatePeriod 滚动周期
+type rotatePeriod struct {
+	name   string        //daily、weekly、monthly,为空时按 d 滚动
+	d      time.Duration //按天对齐的时间间隔
+	layout string        //文件名时间后缀格式
+}
+
+//parseRotatePeriod 解析滚动周期 eg:daily hourly minutely weekly monthly 15m 2h
+func parseRotatePeriod(s string) (p rotatePeriod, err error) {
+	switch s = strings.ToLower(strings.TrimSpace(s)); s {
+	case "", "daily":
+		return rotatePeriod{name: "daily", layout: "20060102"}, nil
+	case "weekly":
+		return rotatePeriod{name: "weekly", layout: "20060102"}, nil
+	case "monthly":
+		return rotatePeriod{name: "monthly", layout: "200601"}, nil
+	case "hourly":
+		p.d = time.Hour
+	case "minutely":
+		p.d = time.Minute
+	default:
+		if p.d, err = time.ParseDuration(s); err != nil {
+			return p, fmt.Errorf("invalid rotate period %q", s)
+		}
+		if p.d < time.Minute || p.d%time.Minute != 0 || p.d > 24*time.Hour {
+			return p, fmt.Errorf("invalid rotate period %q,must be whole minutes within a day", s)
+		}
+	}
+	if p.d%time.Hour == 0 {
+		p.layout = "20060102_15"
+	} else {
+		p.layout = "20060102_1504"
+	}
+	return p, nil
+}
+
+//start 返回 t 所在周期的开始时间
+func (p rotatePeriod) start(t time.Time) time.Time {
+	year, month, day := t.Date()
+	switch p.name {
+	case "daily":
+		return time.Date(year, month, day, 0, 0, 0, 0, t.Location())
+	case "weekly":
+		//以周一作为一周的开始
+		return time.Date(year, month, day-(int(t.Weekday())+6)%7, 0, 0, 0, 0, t.Location())
+	case "monthly":
+		return time.Date(year, month, 1, 0, 0, 0, 0, t.Location())
+	}
+	midnight := time.Date(year, month, day, 0, 0, 0, 0, t.Location())
+	elapsed := t.Sub(midnight)
+	return midnight.Add(elapsed - elapsed%p.d)
+}
+
+//next 返回 t 所在周期的结束时间,即下一次滚动的时间
+func (p rotatePeriod) next(t time.Time) time.Time {
+	start := p.start(t)
+	year, month, day := start.Date()
+	switch p.name {
+	case "daily":
+		return time.Date(year, month, day+1, 0, 0, 0, 0, t.Location())
+	case "weekly":
+		return time.Date(year, month, day+7, 0, 0, 0, 0, t.Location())
+	case "monthly":
+		return time.Date(year, month+1, 1, 0, 0, 0, 0, t.Location())
+	}
+	//按时间间隔滚动的周期每天重新对齐
+	next := start.Add(p.d)
+	if midnight := time.Date(year, month, day+1, 0, 0, 0, 0, t.Location()); next.After(midnight) {
+		next = midnight
+	}
+	return next
+}
+
+//logFileName 返回指定日期、序号的日志文件名 eg:test_20161018.log test_20161018.1.log
+func logFileName(pathfile string, date string, index int) string {
 	dir, fn := filepath.Split(pathfile)
 	ext := path.Ext(fn)
 	if ext != "" {
-		fn = strings.Split(fn, ext)[0] + "_" + time.Now().Format("20060102") + ext
+		fn = strings.Split(fn, ext)[0] + "_" + date
 	} else {
-		fn = fn + "_" + time.Now().Format("20060102")
+		fn = fn + "_" + date
+	}
+	if index > 0 {
+		fn = fn + "." + strconv.Itoa(index)
+	}
+	return filepath.Join(dir, fn+ext)
+}
+
+//openLogFile 从 index 开始打开第一个未写满的日志文件
+func (r *DailyRotate) openLogFile(date string, index int) (f *os.File, size int64, _ int, err error) {
+	for {
+		fn := logFileName(r.fdir, date, index)
+		if _, err := os.Stat(fn + ".gz"); err == nil {
+			//已被压缩的文件不再写入
+			index++
+			continue
+		}
+		if r.maxSize > 0 {
+			if fi, err := os.Stat(fn); err == nil && fi.Size() >= r.maxSize {
+				index++
+				continue
+			}
+		}
+		if f, err = os.OpenFile(fn, DefaultFileFlag, DefaultFileMode); err != nil {
+			return
+		}
+		if fi, err := f.Stat(); err == nil {
+			size = fi.Size()
+		}
+		return f, size, index, nil
 	}
-	return os.OpenFile(filepath.Join(dir, fn), DefaultFileFlag, DefaultFileMode)
 }
 
 // io.WriteCloser.Write()
 func (r *DailyRotate) Write(buf []byte) (n int, err error) {
 	r.mu.Lock()
 	defer r.mu.Unlock()
-	if time.Now().After(r.nextDate) {
-		t := time.Now()
-		t = t.AddDate(0, 0, 1)
-		year, month, day := t.Date()
-		r.nextDate = time.Date(year, month, day, 0, 0, 0, 0, t.Location())
-		if f, err := openLogFile(r.fdir); f != nil && err == nil {
-			r.w.Flush()
-			r.w.Reset(f)
-			r.f.Close()
-			r.f = f
-		}
+	if r.closed {
+		return 0, os.ErrClosed
+	}
+	if t := time.Now(); !t.Before(r.nextDate) {
+		r.rotate(r.period.start(t).Format(r.period.layout), 0)
+		r.nextDate = r.period.next(t)
+	} else if r.maxSize > 0 && r.size > 0 && r.size+int64(len(buf)) > r.maxSize {
+		r.rotate(r.date, r.index+1)
 	}
 	n, err = r.w.Write(buf)
+	r.size += int64(n)
+	return
+}
+
+//WriteLevel 写入指定等级的记录,等级不低于配置的 FlushLevel 时立即刷新缓存
+func (r *DailyRotate) WriteLevel(level LogLevel, buf []byte) (n int, err error) {
+	if n, err = r.Write(buf); err != nil {
+		return
+	}
+	if r.retain.FlushOnLevel && level >= r.retain.FlushLevel {
+		err = r.Flush()
+	}
 	return
 }
 
+//Flush 将缓存中的数据写入文件
+func (r *DailyRotate) Flush() error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.closed {
+		return nil
+	}
+	return r.w.Flush()
+}
+
+//rotate 切换到新的日志文件,打开失败时继续写入当前文件
+func (r *DailyRotate) rotate(date string, index int) {
+	if f, size, index, err := r.openLogFile(date, index); f != nil && err == nil {
+		r.w.Flush()
+		r.w.Reset(f)
+		old := r.f.Name()
+		r.f.Close()
+		r.f = f
+		r.size = size
+		r.date = date
+		r.index = index
+		if !r.retain.DisableSymlink {
+			//持有写锁时不能输出日志,创建失败的原因已在构建时提示
+			updateSymlink(r.fdir, f.Name())
+		}
+		r.afterRotate(old)
+	}
+}
+
+//updateSymlink 将符号链接 link 原子地指向同目录下的 target,link 存在且不是符号链接时不做修改
+func updateSymlink(link string, target string) error {
+	if fi, err := os.Lstat(link); err == nil && fi.Mode()&os.ModeSymlink == 0 {
+		return fmt.Errorf("%s exists and is not a symlink", link)
+	}
+	_, name := filepath.Split(target)
+	tmp := link + ".tmp"
+	os.Remove(tmp)
+	if err := os.Symlink(name, tmp); err != nil {
+		return err
+	}
+	if err := os.Rename(tmp, link); err != nil {
+		os.Remove(tmp)
+		return err
+	}
+	return nil
+}
+
+//afterRotate 后台压缩刚关闭的旧文件并清理超出保留策略的日志文件,不阻塞写入
+func (r *DailyRotate) afterRotate(old string) {
+	c := r.retain
+	compress := old != "" && c.Compress == CompressGzip
+	clean := c.MaxDays > 0 || c.MaxFiles > 0 || c.MaxTotalSize > 0
+	if !compress && !clean {
+		return
+	}
+	current := r.f.Name()
+	r.wg.Add(1)
+	go func() {
+		defer r.wg.Done()
+		r.cleanMu.Lock()
+		defer r.cleanMu.Unlock()
+		if compress {
+			if err := gzipFile(old); err != nil {
+				Warnf("compress log file [%s] err:%v", old, err)
+			}
+		}
+		if clean {
+			if err := cleanLogFiles(r.fdir, current, r.period.layout, c); err != nil {
+				Warnf("clean log file [%s] err:%v", r.fdir, err)
+			}
+		}
+	}()
+}
+
+//gzipFile 将文件压缩为 name.gz,成功后删除原文件,失败时保留原文件
+func gzipFile(name string) (err error) {
+	src, err := os.Open(name)
+	if err != nil {
+		return
+	}
+	defer src.Close()
+	dst, err := os.OpenFile(name+".gz", os.O_CREATE|os.O_TRUNC|os.O_WRONLY, DefaultFileMode)
+	if err != nil {
+		return
+	}
+	defer func() {
+		if err != nil {
+			os.Remove(name + ".gz")
+		}
+	}()
+	zw := gzip.NewWriter(dst)
+	if _, err = io.Copy(zw, src); err != nil {
+		zw.Close()
+		dst.Close()
+		return
+	}
+	if err = zw.Close(); err != nil {
+		dst.Close()
+		return
+	}
+	if err = dst.Close(); err != nil {
+		return
+	}
+	//保留原文件的修改时间,保证按时间清理的顺序
+	if fi, e := src.Stat(); e == nil {
+		os.Chtimes(name+".gz", fi.ModTime(), fi.ModTime())
+	}
+	src.Close()
+	return os.Remove(name)
+}
+
+//cleanLogFiles 按保留策略从最旧的开始删除匹配命名规则的日志文件,当前文件不会被删除,
+//layout 为文件名时间后缀格式,只匹配位数与之相同的时间后缀,避免误删同目录下其他日志(eg:name_2.log)的文件
+func cleanLogFiles(pathfile string, current string, layout string, c RotateConfig) error {
+	dir, fn := filepath.Split(pathfile)
+	ext := path.Ext(fn)
+	base := strings.TrimSuffix(fn, ext)
+	date := digitReg.ReplaceAllString(regexp.QuoteMeta(layout), "[0-9]")
+	reg, err := regexp.Compile("^" + regexp.QuoteMeta(base) + "_" + date + `(\.[0-9]+)?` + regexp.QuoteMeta(ext) + `(\.gz)?$`)
+	if err != nil {
+		return err
+	}
+	if dir == "" {
+		dir = "."
+	}
+	infos, err := ioutil.ReadDir(dir)
+	if err != nil {
+		return err
+	}
+	files := make([]os.FileInfo, 0, len(infos))
+	var total int64
+	_, current = filepath.Split(current)
+	for _, fi := range infos {
+		if fi.IsDir() || !reg.MatchString(fi.Name()) {
+			continue
+		}
+		total += fi.Size()
+		if fi.Name() != current {
+			files = append(files, fi)
+		}
+	}
+	//最旧的文件排在前面
+	sort.Slice(files, func(i, j int) bool { return files[i].ModTime().Before(files[j].ModTime()) })
+	count := len(files) + 1
+	deadline := time.Now().AddDate(0, 0, -c.MaxDays)
+	for _, fi := range files {
+		if !(c.MaxDays > 0 && fi.ModTime().Before(deadline)) &&
+			!(c.MaxFiles > 0 && count > c.MaxFiles) &&
+			!(c.MaxTotalSize > 0 && total > c.MaxTotalSize) {
+			break
+		}
+		if e := os.Remove(filepath.Join(dir, fi.Name())); e != nil {
+			err = e
+			continue
+		}
+		count--
+		total -= fi.Size()
+	}
+	return err
+}
+
 // io.WriteCloser.Close()
 func (r *DailyRotate) Close() error {
 	r.mu.Lock()
-	defer r.mu.Unlock()
+	if r.closed {
+		r.mu.Unlock()
+		return nil
+	}
+	r.closed = true
 	r.w.Flush()
 	r.f.Close()
+	if r.stop != nil {
+		close(r.stop)
+	}
+	r.mu.Unlock()
+	r.wg.Wait()
 	return nil
 }
@@ -0,0 +1,150 @@
+package golog
+
+import (
+	"compress/gzip"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestRotateMaxSize(t *testing.T) {
+	dir := t.TempDir()
+	r, err := NewRotate(RotateConfig{FilePath: filepath.Join(dir, "size.log"), MaxSize: 10})
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i := 0; i < 3; i++ {
+		r.Write([]byte("0123456789"))
+	}
+	r.Close()
+	date := time.Now().Format("20060102")
+	for _, fn := range []string{"size_" + date + ".log", "size_" + date + ".1.log", "size_" + date + ".2.log"} {
+		if fi, err := os.Stat(filepath.Join(dir, fn)); err != nil || fi.Size() != 10 {
+			t.Fatalf("file %s:%v", fn, err)
+		}
+	}
+}
+
+func TestRotateRetention(t *testing.T) {
+	dir := t.TempDir()
+	old := time.Now().AddDate(0, 0, -10)
+	for i, date := range []string{"20160101", "20160102", "20160103"} {
+		fn := filepath.Join(dir, "keep_"+date+".log")
+		ioutil.WriteFile(fn, []byte("x"), DefaultFileMode)
+		os.Chtimes(fn, old.Add(time.Duration(i)*time.Hour), old.Add(time.Duration(i)*time.Hour))
+	}
+	ioutil.WriteFile(filepath.Join(dir, "other_20160101.log"), []byte("x"), DefaultFileMode)
+	//同目录下 keep_2.log 滚动的文件
+	for _, fn := range []string{"keep_2_20160101.log", "keep_2_20160101.1.log"} {
+		ioutil.WriteFile(filepath.Join(dir, fn), []byte("x"), DefaultFileMode)
+		os.Chtimes(filepath.Join(dir, fn), old, old)
+	}
+	r, err := NewRotate(RotateConfig{FilePath: filepath.Join(dir, "keep.log"), MaxFiles: 2})
+	if err != nil {
+		t.Fatal(err)
+	}
+	r.Close()
+	for fn, exist := range map[string]bool{
+		"keep_20160101.log":     false,
+		"keep_20160102.log":     false,
+		"keep_20160103.log":     true,
+		"other_20160101.log":    true,
+		"keep_2_20160101.log":   true,
+		"keep_2_20160101.1.log": true,
+	} {
+		if _, err := os.Stat(filepath.Join(dir, fn)); (err == nil) != exist {
+			t.Fatalf("file %s exist=%v err:%v", fn, exist, err)
+		}
+	}
+}
+
+func TestRotateCompress(t *testing.T) {
+	dir := t.TempDir()
+	r, err := NewRotate(RotateConfig{FilePath: filepath.Join(dir, "gz.log"), MaxSize: 10, Compress: CompressGzip})
+	if err != nil {
+		t.Fatal(err)
+	}
+	r.Write([]byte("0123456789"))
+	r.Write([]byte("0123456789"))
+	r.Close()
+	fn := filepath.Join(dir, "gz_"+time.Now().Format("20060102")+".log")
+	if _, err := os.Stat(fn); !os.IsNotExist(err) {
+		t.Fatalf("rotated file %s not removed:%v", fn, err)
+	}
+	f, err := os.Open(fn + ".gz")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	zr, err := gzip.NewReader(f)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if b, _ := ioutil.ReadAll(zr); string(b) != "0123456789" {
+		t.Fatalf("unexpected content:%q", b)
+	}
+}
+
+func TestRotatePeriod(t *testing.T) {
+	now := time.Date(2016, 10, 18, 15, 47, 30, 0, time.Local)
+	for _, c := range []struct {
+		rotate, name string
+		next         time.Time
+	}{
+		{"", "20161018", time.Date(2016, 10, 19, 0, 0, 0, 0, time.Local)},
+		{"hourly", "20161018_15", time.Date(2016, 10, 18, 16, 0, 0, 0, time.Local)},
+		{"15m", "20161018_1545", time.Date(2016, 10, 18, 16, 0, 0, 0, time.Local)},
+		{"weekly", "20161017", time.Date(2016, 10, 24, 0, 0, 0, 0, time.Local)},
+		{"monthly", "201610", time.Date(2016, 11, 1, 0, 0, 0, 0, time.Local)},
+	} {
+		p, err := parseRotatePeriod(c.rotate)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if name := p.start(now).Format(p.layout); name != c.name || !p.next(now).Equal(c.next) {
+			t.Fatalf("rotate %q: name=%s next=%v", c.rotate, name, p.next(now))
+		}
+	}
+	if _, err := parseRotatePeriod("90s"); err == nil {
+		t.Fatal("expected error for 90s")
+	}
+}
+
+func TestRotateSymlink(t *testing.T) {
+	dir := t.TempDir()
+	link := filepath.Join(dir, "link.log")
+	r, err := NewRotate(RotateConfig{FilePath: link, MaxSize: 10})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer r.Close()
+	r.Write([]byte("0123456789"))
+	r.Write([]byte("abc"))
+	target, err := os.Readlink(link)
+	if err != nil {
+		t.Skipf("symlink not supported:%v", err)
+	}
+	if target != "link_"+time.Now().Format("20060102")+".1.log" {
+		t.Fatalf("unexpected symlink target:%s", target)
+	}
+}
+
+func TestRotateFlushLevel(t *testing.T) {
+	dir := t.TempDir()
+	r, err := NewRotate(RotateConfig{FilePath: filepath.Join(dir, "flush.log"), CacheSize: 4096, FlushOnLevel: true, FlushLevel: LEVEL_ERROR})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer r.Close()
+	fn := filepath.Join(dir, "flush_"+time.Now().Format("20060102")+".log")
+	r.WriteLevel(LEVEL_INFO, []byte("info\n"))
+	if fi, _ := os.Stat(fn); fi.Size() != 0 {
+		t.Fatalf("info flushed:%d", fi.Size())
+	}
+	r.WriteLevel(LEVEL_ERROR, []byte("error\n"))
+	if fi, _ := os.Stat(fn); fi.Size() != 11 {
+		t.Fatalf("error not flushed:%d", fi.Size())
+	}
+}
@@ -0,0 +1,112 @@
+// Copyright 2016 zxfonline@sina.com. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package golog
+
+import (
+	"fmt"
+	"strings"
+	"time"
+)
+
+//DEDUP_TIMEOUT DEDUP 未指定时长时,重复消息汇总的最长等待时间
+var DEDUP_TIMEOUT = 30 * time.Second
+
+//dedup 合并同一调用位置连续相同的消息,输出"last message repeated N times",操作日志不参与合并
+type dedup struct {
+	timeout time.Duration
+	last    Record
+	has     bool
+	count   int
+	timer   *time.Timer
+}
+
+//parseDedup 解析重复消息合并参数,为空时使用 DEDUP_TIMEOUT,off 表示关闭 eg:DEDUP DEDUP(10s) DEDUP(off)
+func parseDedup(param string) (time.Duration, error) {
+	switch {
+	case param == "":
+		return DEDUP_TIMEOUT, nil
+	case strings.EqualFold(param, "off"):
+		return 0, nil
+	}
+	d, err := time.ParseDuration(param)
+	if err != nil || d <= 0 {
+		return 0, fmt.Errorf("invalid DEDUP(%s),eg:DEDUP(10s)", param)
+	}
+	return d, nil
+}
+
+//repeated 与上一条记录相同时计数并返回 true,否则先输出上一条记录的重复汇总,调用时需持有 l.mu
+func (d *dedup) repeated(l *Logger, r *Record) bool {
+	if d.has && sameRecord(&d.last, r) {
+		d.count++
+		if d.timer == nil {
+			var t *time.Timer
+			t = time.AfterFunc(d.timeout, func() {
+				l.mu.Lock()
+				defer l.mu.Unlock()
+				if l.dedup == d && d.timer == t {
+					d.flush(l)
+				}
+			})
+			d.timer = t
+		}
+		return true
+	}
+	d.flush(l)
+	d.last, d.has = *r, true
+	return false
+}
+
+//flush 输出重复汇总,之后相同的记录继续合并,调用时需持有 l.mu
+func (d *dedup) flush(l *Logger) {
+	if d.timer != nil {
+		d.timer.Stop()
+		d.timer = nil
+	}
+	if d.count == 0 {
+		return
+	}
+	r := Record{
+		Time:    time.Now(),
+		Level:   d.last.Level,
+		Name:    d.last.Name,
+		File:    d.last.File,
+		Line:    d.last.Line,
+		Message: fmt.Sprintf("last message repeated %d times", d.count),
+		Flag:    d.last.Flag,
+	}
+	d.count = 0
+	l.write(l.Out, &r)
+}
+
+//sameRecord 等级、调用位置、消息以及结构化字段是否相同
+func sameRecord(a, b *Record) bool {
+	if a.Level != b.Level || a.Name != b.Name || a.Line != b.Line || a.File != b.File || a.Message != b.Message || len(a.Fields) != len(b.Fields) {
+		return false
+	}
+	for i, f := range a.Fields {
+		if f.Key != b.Fields[i].Key || !sameValue(f.Value, b.Fields[i].Value) {
+			return false
+		}
+	}
+	return true
+}
+
+//flushDedups 输出所有记录器的重复汇总
+func flushDedups() {
+	mu.Lock()
+	loggers := make([]*Logger, 0, len(logMap))
+	for _, logger := range logMap {
+		loggers = append(loggers, logger)
+	}
+	mu.Unlock()
+	for _, logger := range loggers {
+		logger.mu.Lock()
+		if logger.dedup != nil {
+			logger.dedup.flush(logger)
+		}
+		logger.mu.Unlock()
+	}
+}
@@ -0,0 +1,179 @@
+// Copyright 2016 zxfonline@sina.com. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package golog
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+//Field 结构化日志字段
+type Field struct {
+	Key   string
+	Value interface{}
+}
+
+//F 构建一个结构化日志字段
+func F(key string, value interface{}) Field {
+	return Field{Key: key, Value: value}
+}
+
+//toFields 将 key,value,key,value... 形式的参数转换成字段列表,参数本身为Field时直接使用
+func toFields(kv []interface{}) []Field {
+	if len(kv) == 0 {
+		return nil
+	}
+	fields := make([]Field, 0, (len(kv)+1)/2)
+	for i := 0; i < len(kv); i++ {
+		switch k := kv[i].(type) {
+		case Field:
+			fields = append(fields, k)
+			continue
+		case []Field:
+			fields = append(fields, k...)
+			continue
+		}
+		key, ok := kv[i].(string)
+		if !ok {
+			key = fmt.Sprint(kv[i])
+		}
+		if i+1 < len(kv) {
+			fields = append(fields, Field{Key: key, Value: kv[i+1]})
+			i++
+		} else {
+			//缺少值的键
+			fields = append(fields, Field{Key: "!BADKEY", Value: key})
+		}
+	}
+	return fields
+}
+
+//joinFields 合并字段,返回新的切片不修改原有字段
+func joinFields(a, b []Field) []Field {
+	if len(b) == 0 {
+		return a
+	}
+	if len(a) == 0 {
+		return b
+	}
+	fields := make([]Field, 0, len(a)+len(b))
+	fields = append(fields, a...)
+	return append(fields, b...)
+}
+
+//appendFields 以 key=value 的文本形式追加字段
+func appendFields(buf *[]byte, fields []Field) {
+	for _, f := range fields {
+		*buf = append(*buf, ' ')
+		*buf = append(*buf, f.Key...)
+		*buf = append(*buf, '=')
+		appendFieldValue(buf, f.Value)
+	}
+}
+
+func appendFieldValue(buf *[]byte, v interface{}) {
+	var s string
+	switch x := v.(type) {
+	case string:
+		s = x
+	case error:
+		s = x.Error()
+	case fmt.Stringer:
+		s = x.String()
+	default:
+		s = fmt.Sprint(v)
+	}
+	if s == "" || strings.ContainsAny(s, " =\"\t\r\n") {
+		*buf = strconv.AppendQuote(*buf, s)
+		return
+	}
+	*buf = append(*buf, s...)
+}
+
+//With 返回一个携带结构化字段的子记录器,子记录器共享父记录器的等级、输出等配置
+//eg: logger.With("player", pid, "shard", 3).Infow("login")
+func (l *Logger) With(kv ...interface{}) *Logger {
+	b := l.base()
+	return &Logger{Name: b.Name, parent: b, fields: joinFields(l.fields, toFields(kv))}
+}
+
+//base 返回持有配置的根记录器
+func (l *Logger) base() *Logger {
+	if l.parent != nil {
+		return l.parent
+	}
+	return l
+}
+
+//Fields 返回记录器携带的结构化字段
+func (l *Logger) Fields() []Field {
+	return l.fields
+}
+
+//Logw 携带结构化字段的操作日志输出
+func (l *Logger) Logw(msg string, kv ...interface{}) {
+	l.logw(LEVEL_LOG, 3, msg, kv)
+}
+
+//Debugw 携带结构化字段的调试消息输出
+func (l *Logger) Debugw(msg string, kv ...interface{}) {
+	l.logw(LEVEL_DEBUG, 3, msg, kv)
+}
+
+//Infow 携带结构化字段的提示消息输出
+func (l *Logger) Infow(msg string, kv ...interface{}) {
+	l.logw(LEVEL_INFO, 3, msg, kv)
+}
+
+//Warnw 携带结构化字段的警告消息输出
+func (l *Logger) Warnw(msg string, kv ...interface{}) {
+	l.logw(LEVEL_WARN, 3, msg, kv)
+}
+
+//Errorw 携带结构化字段的错误消息输出
+func (l *Logger) Errorw(msg string, kv ...interface{}) {
+	l.logw(LEVEL_ERROR, 3, msg, kv)
+}
+
+//Fatalw 携带结构化字段的严重错误消息输出
+func (l *Logger) Fatalw(msg string, kv ...interface{}) {
+	l.logw(LEVEL_FATAL, 3, msg, kv)
+}
+
+//With 返回一个携带结构化字段的默认子记录器
+func With(kv ...interface{}) *Logger {
+	return Trace.With(kv...)
+}
+
+//Logw 携带结构化字段的操作日志输出
+func Logw(msg string, kv ...interface{}) {
+	Trace.logw(LEVEL_LOG, 3, msg, kv)
+}
+
+//Debugw 携带结构化字段的调试消息输出
+func Debugw(msg string, kv ...interface{}) {
+	Trace.logw(LEVEL_DEBUG, 3, msg, kv)
+}
+
+//Infow 携带结构化字段的提示消息输出
+func Infow(msg string, kv ...interface{}) {
+	Trace.logw(LEVEL_INFO, 3, msg, kv)
+}
+
+//Warnw 携带结构化字段的警告消息输出
+func Warnw(msg string, kv ...interface{}) {
+	Trace.logw(LEVEL_WARN, 3, msg, kv)
+}
+
+//Errorw 携带结构化字段的错误消息输出
+func Errorw(msg string, kv ...interface{}) {
+	Trace.logw(LEVEL_ERROR, 3, msg, kv)
+}
+
+//Fatalw 携带结构化字段的严重错误消息输出
+func Fatalw(msg string, kv ...interface{}) {
+	Trace.logw(LEVEL_FATAL, 3, msg, kv)
+}
@@ -0,0 +1,130 @@
+// Copyright 2016 zxfonline@sina.com. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package golog
+
+import (
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+)
+
+//Record 一条待格式化的日志记录
+type Record struct {
+	Time    time.Time
+	Level   LogLevel
+	Name    string //记录器名称
+	File    string //调用文件,未开启 Lshortfile|Llongfile 时为空
+	Line    int
+	Message string
+	Stack   []byte //DUMPSTACK 开启时 ERROR、FATAL 的堆栈信息
+	Fields  []Field
+	Flag    int //记录器输出标记
+}
+
+//Formatter 日志格式化接口,将记录追加到 buf 中并返回,每条记录需以换行结尾
+type Formatter interface {
+	Format(buf []byte, r *Record) []byte
+}
+
+//FormatterFunc 函数形式的格式化器
+type FormatterFunc func(buf []byte, r *Record) []byte
+
+func (f FormatterFunc) Format(buf []byte, r *Record) []byte {
+	return f(buf, r)
+}
+
+var (
+	formatterMu sync.RWMutex
+	formatters  = make(map[string]Formatter)
+	//DefaultFormatter 记录器未指定格式化器时使用的默认格式
+	DefaultFormatter Formatter = TextFormatter{}
+)
+
+func init() {
+	RegisterFormatter("TEXT", TextFormatter{})
+	RegisterFormatter("JSON", JSONFormatter{})
+	RegisterFormatter("CSV", CSVFormatter{})
+}
+
+//RegisterFormatter 注册格式化器,注册后可在配置文件 [log4go]、[logger] 中按名称(不区分大小写)引用
+//eg: RegisterFormatter("MYFMT", f) ==> [logger]test=INFO,CONSOLE,MYFMT
+func RegisterFormatter(name string, f Formatter) {
+	formatterMu.Lock()
+	defer formatterMu.Unlock()
+	if f == nil {
+		delete(formatters, strings.ToUpper(name))
+		return
+	}
+	formatters[strings.ToUpper(name)] = f
+}
+
+//GetFormatter 根据名称获取格式化器
+func GetFormatter(name string) (Formatter, bool) {
+	formatterMu.RLock()
+	defer formatterMu.RUnlock()
+	f, ok := formatters[strings.ToUpper(name)]
+	return f, ok
+}
+
+//TextFormatter 默认文本格式: 2009/01/23 01:23:23.123123 [INFO ] name d.go:23: message key=value
+type TextFormatter struct{}
+
+func (TextFormatter) Format(buf []byte, r *Record) []byte {
+	formatHeader(r.Flag, &buf, r.Time, r.File, r.Line, LevelString[r.Level]+" "+r.Name)
+	s := r.Message
+	if len(r.Fields) > 0 {
+		buf = append(buf, strings.TrimSuffix(s, "\n")...)
+		appendFields(&buf, r.Fields)
+		buf = append(buf, '\n')
+	} else {
+		buf = append(buf, s...)
+		if len(s) == 0 || s[len(s)-1] != '\n' {
+			buf = append(buf, '\n')
+		}
+	}
+	if len(r.Stack) > 0 {
+		buf = append(buf, "Stack:\n"...)
+		buf = append(buf, r.Stack...)
+	}
+	return buf
+}
+
+//CSVFormatter CSV 格式: 时间,等级,记录器名称,调用位置,消息,key=value...
+//每个结构化字段单独一列,便于审计系统导入
+type CSVFormatter struct{}
+
+func (CSVFormatter) Format(buf []byte, r *Record) []byte {
+	buf = r.Time.AppendFormat(buf, JSONTimeLayout)
+	buf = append(buf, ',')
+	buf = append(buf, levelNames[r.Level]...)
+	buf = append(buf, ',')
+	buf = appendCSV(buf, r.Name)
+	buf = append(buf, ',')
+	if r.Flag&(Lshortfile|Llongfile) != 0 {
+		buf = appendCSV(buf, callerString(r.Flag, r.File, r.Line))
+	}
+	buf = append(buf, ',')
+	buf = appendCSV(buf, strings.TrimSuffix(r.Message, "\n"))
+	var field []byte
+	for _, f := range r.Fields {
+		field = append(field[:0], f.Key...)
+		field = append(field, '=')
+		field = append(field, fmt.Sprint(f.Value)...)
+		buf = append(buf, ',')
+		buf = appendCSV(buf, string(field))
+	}
+	return append(buf, '\n')
+}
+
+//appendCSV 追加CSV字段,包含逗号、引号、换行时使用双引号包围
+func appendCSV(buf []byte, s string) []byte {
+	if !strings.ContainsAny(s, ",\"\r\n") {
+		return append(buf, s...)
+	}
+	buf = append(buf, '"')
+	buf = append(buf, strings.Replace(s, `"`, `""`, -1)...)
+	return append(buf, '"')
+}
@@ -0,0 +1,119 @@
+// Copyright 2016 zxfonline@sina.com. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package golog
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+	"unicode/utf8"
+)
+
+//JSON 时间输出格式
+var JSONTimeLayout = "2006-01-02T15:04:05.000000Z07:00"
+
+//JSONFormatter 以单行JSON对象的格式输出一条日志记录
+//eg: {"ts":"2016-10-18T15:04:05.000000+08:00","level":"INFO","logger":"game","caller":"d.go:23","msg":"login","player":1001}
+type JSONFormatter struct{}
+
+func (JSONFormatter) Format(buf []byte, r *Record) []byte {
+	buf = append(buf, `{"ts":"`...)
+	buf = r.Time.AppendFormat(buf, JSONTimeLayout)
+	buf = append(buf, `","level":`...)
+	appendJSONString(&buf, levelNames[r.Level])
+	buf = append(buf, `,"logger":`...)
+	appendJSONString(&buf, r.Name)
+	if r.Flag&(Lshortfile|Llongfile) != 0 {
+		buf = append(buf, `,"caller":`...)
+		appendJSONString(&buf, callerString(r.Flag, r.File, r.Line))
+	}
+	buf = append(buf, `,"msg":`...)
+	appendJSONString(&buf, strings.TrimSuffix(r.Message, "\n"))
+	if len(r.Stack) > 0 {
+		buf = append(buf, `,"stack":`...)
+		appendJSONString(&buf, string(r.Stack))
+	}
+	for _, f := range r.Fields {
+		buf = append(buf, ',')
+		appendJSONString(&buf, f.Key)
+		buf = append(buf, ':')
+		appendJSONValue(&buf, f.Value)
+	}
+	return append(buf, "}\n"...)
+}
+
+//callerString 根据输出标记返回调用位置 file:line
+func callerString(flag int, file string, line int) string {
+	if flag&Lshortfile != 0 {
+		file = shortFile(file)
+	}
+	return fmt.Sprintf("%s:%d", file, line)
+}
+
+func appendJSONValue(buf *[]byte, v interface{}) {
+	switch x := v.(type) {
+	case nil:
+		*buf = append(*buf, "null"...)
+		return
+	case string:
+		appendJSONString(buf, x)
+		return
+	case error:
+		appendJSONString(buf, x.Error())
+		return
+	case json.Marshaler:
+	case fmt.Stringer:
+		appendJSONString(buf, x.String())
+		return
+	}
+	if b, err := json.Marshal(v); err == nil {
+		*buf = append(*buf, b...)
+	} else {
+		appendJSONString(buf, fmt.Sprint(v))
+	}
+}
+
+const hex = "0123456789abcdef"
+
+//appendJSONString 追加转义后的JSON字符串
+func appendJSONString(buf *[]byte, s string) {
+	*buf = append(*buf, '"')
+	start := 0
+	for i := 0; i < len(s); {
+		if c := s[i]; c < utf8.RuneSelf {
+			if c >= 0x20 && c != '"' && c != '\\' {
+				i++
+				continue
+			}
+			*buf = append(*buf, s[start:i]...)
+			switch c {
+			case '"', '\\':
+				*buf = append(*buf, '\\', c)
+			case '\n':
+				*buf = append(*buf, '\\', 'n')
+			case '\r':
+				*buf = append(*buf, '\\', 'r')
+			case '\t':
+				*buf = append(*buf, '\\', 't')
+			default:
+				*buf = append(*buf, '\\', 'u', '0', '0', hex[c>>4], hex[c&0xF])
+			}
+			i++
+			start = i
+			continue
+		}
+		r, size := utf8.DecodeRuneInString(s[i:])
+		if r == utf8.RuneError && size == 1 {
+			*buf = append(*buf, s[start:i]...)
+			*buf = append(*buf, "\ufffd"...)
+			i += size
+			start = i
+			continue
+		}
+		i += size
+	}
+	*buf = append(*buf, s[start:]...)
+	*buf = append(*buf, '"')
+}
@@ -0,0 +1,196 @@
+// Copyright 2016 zxfonline@sina.com. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package golog
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+)
+
+//DefaultPatternTimeLayout %d 未指定时间格式时使用的格式
+const DefaultPatternTimeLayout = "2006/01/02 15:04:05.000000"
+
+//PatternFormatter log4j 风格的转换模式格式化器,支持的转换符:
+//%d{layout} 时间,layout 为 go 时间格式,缺省为 DefaultPatternTimeLayout
+//%p 等级名称 DEBUG、INFO...  %P 带颜色的等级前缀(同默认文本格式)
+//%c 记录器名称
+//%F 调用文件名  %f 调用文件全路径  %L 调用行号  %l 调用位置 file:line
+//%m 日志消息  %X 全部结构化字段 key=value  %X{key} 指定字段的值
+//%n 换行  %% 百分号
+//转换符前可加宽度进行填充,负号表示左对齐,eg: %-5p %20c
+//调用文件需记录器开启 Lshortfile 或 Llongfile,堆栈信息(DUMPSTACK)追加在记录末尾
+//eg: %d{2006-01-02 15:04:05.000} %-5p [%c] %F:%L - %m%n
+type PatternFormatter struct {
+	pattern string
+	items   []patternItem
+}
+
+type patternItem struct {
+	verb  byte   //转换符,0 表示字面量
+	arg   string //字面量或 {} 中的参数
+	width int
+	left  bool
+}
+
+//NewPatternFormatter 解析转换模式构建格式化器
+func NewPatternFormatter(pattern string) (*PatternFormatter, error) {
+	p := &PatternFormatter{pattern: pattern}
+	lit := make([]byte, 0, len(pattern))
+	for i := 0; i < len(pattern); i++ {
+		c := pattern[i]
+		if c != '%' {
+			lit = append(lit, c)
+			continue
+		}
+		i++
+		if i >= len(pattern) {
+			return nil, fmt.Errorf("pattern %q: dangling %%", pattern)
+		}
+		if pattern[i] == '%' {
+			lit = append(lit, '%')
+			continue
+		}
+		if len(lit) > 0 {
+			p.items = append(p.items, patternItem{arg: string(lit)})
+			lit = lit[:0]
+		}
+		item := patternItem{}
+		if pattern[i] == '-' {
+			item.left = true
+			i++
+		}
+		start := i
+		for i < len(pattern) && pattern[i] >= '0' && pattern[i] <= '9' {
+			i++
+		}
+		if i > start {
+			item.width, _ = strconv.Atoi(pattern[start:i])
+		}
+		if i >= len(pattern) {
+			return nil, fmt.Errorf("pattern %q: missing conversion verb", pattern)
+		}
+		item.verb = pattern[i]
+		switch item.verb {
+		case 'd', 'p', 'P', 'c', 'F', 'f', 'L', 'l', 'm', 'X', 'n':
+		default:
+			return nil, fmt.Errorf("pattern %q: unknown conversion %%%c", pattern, item.verb)
+		}
+		if i+1 < len(pattern) && pattern[i+1] == '{' {
+			end := strings.IndexByte(pattern[i+1:], '}')
+			if end < 0 {
+				return nil, fmt.Errorf("pattern %q: unclosed {", pattern)
+			}
+			item.arg = pattern[i+2 : i+1+end]
+			i += 1 + end
+		}
+		if item.verb == 'd' && item.arg == "" {
+			item.arg = DefaultPatternTimeLayout
+		}
+		p.items = append(p.items, item)
+	}
+	if len(lit) > 0 {
+		p.items = append(p.items, patternItem{arg: string(lit)})
+	}
+	return p, nil
+}
+
+//Pattern 返回转换模式
+func (p *PatternFormatter) Pattern() string {
+	return p.pattern
+}
+
+func (p *PatternFormatter) Format(buf []byte, r *Record) []byte {
+	for _, item := range p.items {
+		if item.verb == 0 {
+			buf = append(buf, item.arg...)
+			continue
+		}
+		start := len(buf)
+		switch item.verb {
+		case 'd':
+			buf = r.Time.AppendFormat(buf, item.arg)
+		case 'p':
+			buf = append(buf, levelNames[r.Level]...)
+		case 'P':
+			buf = append(buf, LevelString[r.Level]...)
+		case 'c':
+			buf = append(buf, r.Name...)
+		case 'F':
+			buf = append(buf, shortFile(r.File)...)
+		case 'f':
+			buf = append(buf, r.File...)
+		case 'L':
+			itoa(&buf, r.Line, -1)
+		case 'l':
+			buf = append(buf, shortFile(r.File)...)
+			buf = append(buf, ':')
+			itoa(&buf, r.Line, -1)
+		case 'm':
+			buf = append(buf, strings.TrimSuffix(r.Message, "\n")...)
+		case 'X':
+			if item.arg == "" {
+				appendFields(&buf, r.Fields)
+				if len(buf) > start {
+					//去掉首个字段前的空格
+					buf = append(buf[:start], buf[start+1:]...)
+				}
+			} else {
+				for _, f := range r.Fields {
+					if f.Key == item.arg {
+						appendFieldValue(&buf, f.Value)
+						break
+					}
+				}
+			}
+		case 'n':
+			buf = append(buf, '\n')
+		}
+		if item.width > 0 {
+			buf = pad(buf, start, item.width, item.left)
+		}
+	}
+	if len(buf) == 0 || buf[len(buf)-1] != '\n' {
+		buf = append(buf, '\n')
+	}
+	if len(r.Stack) > 0 {
+		buf = append(buf, "Stack:\n"...)
+		buf = append(buf, r.Stack...)
+	}
+	return buf
+}
+
+//pad 将 buf[start:] 填充空格至 width 宽度
+func pad(buf []byte, start int, width int, left bool) []byte {
+	n := width - utf8.RuneCount(buf[start:])
+	if n <= 0 {
+		return buf
+	}
+	if left {
+		for ; n > 0; n-- {
+			buf = append(buf, ' ')
+		}
+		return buf
+	}
+	end := len(buf)
+	for i := 0; i < n; i++ {
+		buf = append(buf, ' ')
+	}
+	copy(buf[start+n:], buf[start:end])
+	for i := start; i < start+n; i++ {
+		buf[i] = ' '
+	}
+	return buf
+}
+
+func shortFile(file string) string {
+	for i := len(file) - 1; i > 0; i-- {
+		if file[i] == '/' {
+			return file[i+1:]
+		}
+	}
+	return file
+}
@@ -7,9 +7,11 @@ package golog
 import (
 	"fmt"
 	"io"
+	"os"
 	"runtime"
 	"runtime/debug"
 	"sync"
+	"sync/atomic"
 	"time"
 )
 
@@ -28,11 +30,13 @@ const (
 
 	Lconsole   //控制台是否同时输出
 	Lfilexport //日志文件是否输出
+	Lasync     //是否异步输出,格式化后的记录放入队列由单独的协程写出
 
 	LstdFlags = Ldate | Lmicroseconds | Lshortfile //标准输出格式
 )
 
-type LogLevel int
+//LogLevel 日志等级,记录器的等级使用原子操作读写
+type LogLevel int32
 
 const (
 	LEVEL_DEBUG LogLevel = iota
@@ -52,6 +56,16 @@ var LevelString = [...]string{
 	"[LOG  ]",
 }
 
+//不带颜色的等级名称,用于结构化输出
+var levelNames = [...]string{
+	"DEBUG",
+	"INFO",
+	"WARN",
+	"ERROR",
+	"FATAL",
+	"LOG",
+}
+
 func init() {
 	if runtime.GOOS != "windows" {
 		LevelString = [...]string{
@@ -77,6 +91,16 @@ type Logger struct {
 	Level LogLevel
 	Name  string
 	Trace bool
+	//Formatter 日志格式化器,为空时使用 DefaultFormatter
+	Formatter Formatter
+	//Appenders 额外的输出目标,各自按照自身的等级、格式输出
+	Appenders []Appender
+
+	parent *Logger // With 创建的子记录器指向持有配置的根记录器
+	fields []Field // 结构化字段
+
+	sampler *sampler // 采样及限流
+	dedup   *dedup   // 重复消息合并
 }
 
 // New creates a new Logger.   The out variable sets the
@@ -165,15 +189,21 @@ func formatHeader(flag int, buf *[]byte, t time.Time, file string, line int, pre
 }
 
 // output writes the output for a logging event.  The string s contains
-// the text to print after the prefix specified by the flags of the
-// Logger.  A newline is appended if the last character of s is not
-// already a newline.  Calldepth is used to recover the PC and is
-// provided for generality, although at the moment on all pre-defined
-// paths it will be 2.
-func (l *Logger) output(level LogLevel, calldepth int, prefix string, s string) {
-	t := time.Now() // get this early.
+// the message text, it is handed to the Logger's Formatter together with
+// the time, level, caller and fields of the event.  Calldepth is used to
+// recover the PC and is provided for generality, although at the moment
+// on all pre-defined paths it will be 2.
+func (l *Logger) output(level LogLevel, calldepth int, s string, fields []Field) {
+	l.outputAt(time.Now(), level, calldepth+1, 0, s, fields)
+}
+
+//outputAt 输出日志,pc 不为 0 时以 pc 作为调用位置,否则根据 calldepth 获取调用位置,
+//calldepth 为 callerSearch 时从调用栈中查找适配器之外的调用位置,其余 calldepth<=0 时未知
+func (l *Logger) outputAt(t time.Time, level LogLevel, calldepth int, pc uintptr, s string, fields []Field) {
 	var file string
 	var line int
+	name := l.Name
+	l = l.base()
 	l.mu.Lock()
 	defer l.mu.Unlock()
 	flag := l.Flag
@@ -182,34 +212,67 @@ func (l *Logger) output(level LogLevel, calldepth int, prefix string, s string)
 		// release lock while getting caller info - it's expensive.
 		l.mu.Unlock()
 		var ok bool
-		_, file, line, ok = runtime.Caller(calldepth)
+		if pc != 0 {
+			f, _ := runtime.CallersFrames([]uintptr{pc}).Next()
+			file, line, ok = f.File, f.Line, f.File != ""
+		} else if calldepth > 0 {
+			_, file, line, ok = runtime.Caller(calldepth)
+		} else if calldepth == callerSearch {
+			file, line, ok = searchCaller()
+		}
 		if !ok {
 			file = "???"
 			line = 0
 		}
 		l.mu.Lock()
+		//释放锁期间输出流可能已被重新加载替换并关闭
+		flag, out = l.Flag, l.Out
 	}
-	buf := l.buf[:0]
-	formatHeader(flag, &buf, t, file, line, prefix)
-	buf = append(buf, s...)
-	if len(s) > 0 && s[len(s)-1] != '\n' {
-		buf = append(buf, '\n')
+	r := Record{Time: t, Level: level, Name: name, File: file, Line: line, Message: s, Fields: fields, Flag: flag}
+	if l.dedup != nil && level != LEVEL_LOG && l.dedup.repeated(l, &r) {
+		return
 	}
 	if l.Trace {
 		switch level {
 		case LEVEL_ERROR, LEVEL_FATAL:
-			buf = append(buf, "Stack:\n"...)
-			buf = append(buf, debug.Stack()...)
+			r.Stack = debug.Stack()
 		default:
 		}
 	}
+	l.write(out, &r)
+}
+
+//write 格式化并输出记录,调用时需持有 l.mu
+func (l *Logger) write(out io.Writer, r *Record) {
+	formatter := l.Formatter
+	if formatter == nil {
+		formatter = DefaultFormatter
+	}
+	buf := formatter.Format(l.buf[:0], r)
+	l.buf = buf
+	if r.Flag&Lasync != 0 {
+		asyncWrite(r.Level, r.Flag, out, buf, l.Appenders, r)
+	} else {
+		writeTo(r.Level, r.Flag, out, buf, l.Appenders, r)
+	}
+}
+
+//writeTo 将格式化后的记录写入输出标记对应的输出流及各个输出目标,
+//配置了操作日志输出目标时,操作日志只写入该目标而不写入日志文件
+func writeTo(level LogLevel, flag int, out io.Writer, buf []byte, as []Appender, r *Record) {
 	//	var err error
-	if flag&Lfilexport != 0 {
-		/*_, err =*/ out.Write(buf)
+	opLogged := level == LEVEL_LOG && writeOpLog(r)
+	if opLogged {
+		//操作日志已写入专用输出目标
+	} else if flag&Lfilexport != 0 {
+		if _, err := writeLevel(out, level, buf); err != nil {
+			//写入失败时输出到标准错误,避免记录丢失
+			fmt.Fprintf(os.Stderr, "write log err:%v\n%s", err, buf)
+		}
 	} else if level == LEVEL_LOG && (LstaticIo != defaultWriter || flag&Lconsole == 0) {
 		//保证该操作日志必须打印出来
 		/*_, err =*/
-		LstaticIo.Write(buf)
+		writeLevel(LstaticIo, level, buf)
 	}
 	if flag&Lconsole != 0 {
 		/*_, err =*/ defaultWriter.Write(buf)
@@ -217,24 +280,46 @@ func (l *Logger) output(level LogLevel, calldepth int, prefix string, s string)
 	//	if err != nil {
 	//		fmt.Printf("write log err:%v\n", err)
 	//	}
+	if !opLogged {
+		//操作日志已写入专用输出目标时不再输出到其他输出目标
+		appendTo(as, r)
+	}
+}
+
+//levelWriter 可根据记录等级处理写入的输出流,eg:DailyRotate 根据等级立即刷新缓存
+type levelWriter interface {
+	WriteLevel(level LogLevel, buf []byte) (int, error)
+}
+
+func writeLevel(w io.Writer, level LogLevel, buf []byte) (int, error) {
+	if lw, ok := w.(levelWriter); ok {
+		return lw.WriteLevel(level, buf)
+	}
+	return w.Write(buf)
 }
 
 func (l *Logger) log(level LogLevel, calldepth int, format string, v ...interface{}) {
-	if level == LEVEL_LOG {
+	if (level == LEVEL_LOG || level >= l.level()) && !l.sampled(level, calldepth, format) {
 		if format == "" {
-			l.output(level, calldepth, fmt.Sprintf("%s %s", LevelString[level], l.Name), fmt.Sprintln(v...))
+			l.output(level, calldepth, fmt.Sprintln(v...), l.fields)
 		} else {
-			l.output(level, calldepth, fmt.Sprintf("%s %s", LevelString[level], l.Name), fmt.Sprintf(format, v...))
-		}
-	} else if int(level) >= int(l.Level) {
-		if format == "" {
-			l.output(level, calldepth, fmt.Sprintf("%s %s", LevelString[level], l.Name), fmt.Sprintln(v...))
-		} else {
-			l.output(level, calldepth, fmt.Sprintf("%s %s", LevelString[level], l.Name), fmt.Sprintf(format, v...))
+			l.output(level, calldepth, fmt.Sprintf(format, v...), l.fields)
 		}
 	}
 }
 
+//logw 携带结构化字段输出, kv 为 key,value,key,value... 形式的参数
+func (l *Logger) logw(level LogLevel, calldepth int, msg string, kv []interface{}) {
+	if (level == LEVEL_LOG || level >= l.level()) && !l.sampled(level, calldepth, msg) {
+		l.output(level, calldepth, msg, joinFields(l.fields, toFields(kv)))
+	}
+}
+
+//level 返回记录器当前等级,等级可能被重新加载配置、管理接口等后台协程修改
+func (l *Logger) level() LogLevel {
+	return LogLevel(atomic.LoadInt32((*int32)(&l.base().Level)))
+}
+
 //根据日志等级输出
 func (l *Logger) Println(level LogLevel, v ...interface{}) {
 	l.log(level, 3, "", v...)
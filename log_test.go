@@ -1,13 +1,52 @@
 package golog
 
 import (
+	"bytes"
+	"context"
+	"encoding/json"
 	"fmt"
+	"io/ioutil"
+	"log"
 	"math/rand"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
 	"sync"
+	"sync/atomic"
 	"testing"
 	"time"
 )
 
+//initTestConfig 将配置写入 dir 下的 log4go.cfg 并加载,测试结束时关闭日志并恢复默认配置,返回配置文件路径
+func initTestConfig(t *testing.T, dir, content string) string {
+	cfg := filepath.Join(dir, "log4go.cfg")
+	if err := ioutil.WriteFile(cfg, []byte(content), 0644); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(resetTestConfig)
+	InitConfig(cfg)
+	return cfg
+}
+
+//resetTestConfig 关闭日志,将全局配置、[logger]配置、临时等级恢复为默认值并重新应用到所有记录器
+func resetTestConfig() {
+	Close()
+	mu.Lock()
+	defer mu.Unlock()
+	for name, tl := range tempLevels {
+		tl.timer.Stop()
+		delete(tempLevels, name)
+	}
+	overrides = make(map[string][]string)
+	fileSections = make(map[string]RotateConfig)
+	configRoot = defaultSettings()
+	setRoot(configRoot)
+	cfgPath = ""
+	applyConfig()
+}
+
 func randInt(min int, max int) int {
 	rand.Seed(time.Now().UTC().UnixNano())
 	return min + rand.Intn(max-min)
@@ -21,6 +60,7 @@ func TestLevel(t *testing.T) {
 	logex2 := New("test2")
 
 	InitConfig("./log4go.cfg")
+	t.Cleanup(resetTestConfig)
 
 	for i := 0; i < 1; i++ {
 		wg.Add(1)
@@ -49,6 +89,587 @@ func TestLevel(t *testing.T) {
 	wg.Wait()
 	Close()
 }
+func TestWith(t *testing.T) {
+	buf := &bytes.Buffer{}
+	logex := NewExt("fields", buf, Lfilexport)
+	logex.With("player", 1001).Infow("login", "shard", 3, "name", "a b")
+	if s := buf.String(); !strings.Contains(s, `login player=1001 shard=3 name="a b"`+"\n") {
+		t.Fatalf("unexpected output:%q", s)
+	}
+}
+
+func TestJSON(t *testing.T) {
+	buf := &bytes.Buffer{}
+	logex := NewExt("json", buf, Lfilexport|Lshortfile)
+	logex.Formatter = JSONFormatter{}
+	logex.With("player", 1001).Warnf("go_%d \"warn\"", 1)
+	m := make(map[string]interface{})
+	if err := json.Unmarshal(buf.Bytes(), &m); err != nil {
+		t.Fatalf("unmarshal %q err:%v", buf.String(), err)
+	}
+	if m["level"] != "WARN" || m["logger"] != "json" || m["msg"] != `go_1 "warn"` || m["player"] != float64(1001) {
+		t.Fatalf("unexpected output:%v", m)
+	}
+	if c, _ := m["caller"].(string); !strings.HasPrefix(c, "log_test.go:") {
+		t.Fatalf("unexpected caller:%v", m["caller"])
+	}
+}
+
+func TestPatternFormatter(t *testing.T) {
+	f, err := NewPatternFormatter("%d{2006-01-02} %-5p|%6c|%%%F:%L - %m %X{player}")
+	if err != nil {
+		t.Fatal(err)
+	}
+	r := &Record{
+		Time:    time.Date(2016, 10, 18, 15, 4, 5, 0, time.Local),
+		Level:   LEVEL_WARN,
+		Name:    "game",
+		File:    "/a/b/c/d.go",
+		Line:    23,
+		Message: "hello\n",
+		Fields:  []Field{F("player", 1001)},
+	}
+	if s := string(f.Format(nil, r)); s != "2016-10-18 WARN |  game|%d.go:23 - hello 1001\n" {
+		t.Fatalf("unexpected output:%q", s)
+	}
+	if _, err = NewPatternFormatter("%q"); err == nil {
+		t.Fatal("expected error for unknown conversion")
+	}
+}
+
+func TestAsync(t *testing.T) {
+	buf := &bytes.Buffer{}
+	logex := NewExt("async", buf, Lfilexport|Lasync)
+	for i := 0; i < 100; i++ {
+		logex.Infof("go_%d info信息", i)
+	}
+	closeAsync()
+	if n := strings.Count(buf.String(), "\n"); n != 100 {
+		t.Fatalf("unexpected line count:%d", n)
+	}
+}
+
+type writerFunc func(p []byte) (int, error)
+
+func (f writerFunc) Write(p []byte) (int, error) { return f(p) }
+
+func TestAsyncDropOldestFlush(t *testing.T) {
+	SetAsync(4, OverflowDropOldest, LEVEL_WARN)
+	defer SetAsync(ASYNC_QUEUE_SIZE, OverflowBlock, LEVEL_WARN)
+	out := writerFunc(func(p []byte) (int, error) {
+		time.Sleep(time.Millisecond)
+		return len(p), nil
+	})
+	NewExt("async_drop", out, Lfilexport|Lasync).Infof("go_%d info信息", 0)
+	stop := make(chan struct{})
+	var wg sync.WaitGroup
+	for i := 0; i < 4; i++ {
+		wg.Add(1)
+		go func(logex *Logger) {
+			defer wg.Done()
+			for {
+				select {
+				case <-stop:
+					return
+				default:
+					logex.Infof("go_%d info信息", 1)
+				}
+			}
+		}(NewExt("async_drop", out, Lfilexport|Lasync))
+	}
+	done := make(chan struct{})
+	go func() {
+		for i := 0; i < 20; i++ {
+			Flush()
+		}
+		close(done)
+	}()
+	select {
+	case <-done:
+	case <-time.After(5 * time.Second):
+		t.Error("Flush blocked under drop_oldest")
+	}
+	close(stop)
+	wg.Wait()
+}
+
+func TestAppender(t *testing.T) {
+	out, warn := &bytes.Buffer{}, &bytes.Buffer{}
+	logex := NewExt("appender", out, Lfilexport)
+	logex.Appenders = []Appender{NewWriterAppender("warn", warn, LEVEL_WARN, JSONFormatter{})}
+	logex.Infof("go_%d info信息", 1)
+	logex.Warnf("go_%d warn信息", 2)
+	if n := strings.Count(out.String(), "\n"); n != 2 {
+		t.Fatalf("unexpected out line count:%d", n)
+	}
+	if s := warn.String(); strings.Count(s, "\n") != 1 || !strings.Contains(s, `"msg":"go_2 warn信息"`) {
+		t.Fatalf("unexpected appender output:%q", s)
+	}
+}
+
+func TestAppenderReload(t *testing.T) {
+	dir := t.TempDir()
+	content := "[log4go]\nrootLogger=INFO,CONSOLE\n[appender.reload_file]\nfilePath=" + filepath.Join(dir, "reload.log") + "\nlevel=WARN\n"
+	cfg := initTestConfig(t, dir, content)
+	a, ok := GetAppender("reload_file")
+	if !ok {
+		t.Fatal("appender not registered")
+	}
+	InitConfig(cfg)
+	if b, _ := GetAppender("reload_file"); b != a {
+		t.Fatal("unchanged appender replaced on reload")
+	}
+	ioutil.WriteFile(cfg, []byte(content+"max_days=3\n"), 0644)
+	InitConfig(cfg)
+	if b, _ := GetAppender("reload_file"); b == a {
+		t.Fatal("changed appender not replaced on reload")
+	}
+	Close()
+	if _, ok := GetAppender("reload_file"); ok {
+		t.Fatal("appender still registered after Close")
+	}
+}
+
+func TestLoggerFile(t *testing.T) {
+	dir := t.TempDir()
+	initTestConfig(t, dir, `[daily_file]
+filePath=`+filepath.Join(dir, "daily.log")+`
+log_iocache_size=4096
+[file.file2]
+filePath=`+filepath.Join(dir, "file2.log")+`
+[appender.file3]
+filePath=`+filepath.Join(dir, "file3.log")+`
+[oplog]
+filePath=`+filepath.Join(dir, "file4.log")+`
+[log4go]
+rootLogger=DEBUG,DAILY_ROLLING_FILE
+[logger]
+file1=INFO,DAILY_ROLLING_FILE(`+filepath.Join(dir, "file1.log")+`),file3
+file2=INFO,DAILY_ROLLING_FILE
+`)
+	logex1 := New("file1")
+	logex2 := New("file2")
+	logex1.Infof("file1 info信息")
+	logex2.Infof("file2 info信息")
+	logex1.Infof("file3 info信息")
+	logex2.Logf("file4 info信息")
+	Flush()
+	date := time.Now().Format("20060102")
+	for _, name := range []string{"file1", "file2", "file3", "file4"} {
+		b, err := ioutil.ReadFile(filepath.Join(dir, name+"_"+date+".log"))
+		if err != nil || !strings.Contains(string(b), name+" info信息") {
+			t.Fatalf("logger file %s:%q err:%v", name, b, err)
+		}
+	}
+}
+
+func TestOpLog(t *testing.T) {
+	out, op := &bytes.Buffer{}, &bytes.Buffer{}
+	old := SetOpLogAppender(NewWriterAppender("oplog", op, LEVEL_LOG, CSVFormatter{}))
+	defer SetOpLogAppender(old)
+	errs := &bytes.Buffer{}
+	logex := NewExt("oplog", out, Lfilexport)
+	logex.Appenders = []Appender{NewWriterAppender("errs", errs, LEVEL_ERROR, nil)}
+	logex.Infof("go_%d info信息", 1)
+	logex.With("player", 1001).Logw("buy, item", "item", 3)
+	if n := strings.Count(out.String(), "\n"); n != 1 {
+		t.Fatalf("unexpected out line count:%d", n)
+	}
+	if s := op.String(); !strings.HasSuffix(s, `,LOG,oplog,,"buy, item",player=1001,item=3`+"\n") {
+		t.Fatalf("unexpected oplog output:%q", s)
+	}
+	if errs.Len() != 0 {
+		t.Fatalf("oplog record written to appender:%q", errs)
+	}
+}
+
+func TestReload(t *testing.T) {
+	dir := t.TempDir()
+	content := func(name string) string {
+		return `[daily_file]
+filePath=` + filepath.Join(dir, name) + `
+log_iocache_size=0
+[log4go]
+rootLogger=INFO,DAILY_ROLLING_FILE
+`
+	}
+	cfg := initTestConfig(t, dir, content("before.log"))
+	logex := New("reload")
+	logex.Infof("before reload")
+	ioutil.WriteFile(cfg, []byte(content("after.log")), 0644)
+	ReLoad()
+	logex.Infof("after reload")
+	Close()
+	date := time.Now().Format("20060102")
+	for _, name := range []string{"before", "after"} {
+		b, err := ioutil.ReadFile(filepath.Join(dir, name+"_"+date+".log"))
+		if err != nil || !strings.Contains(string(b), name+" reload") {
+			t.Fatalf("log file %s:%q err:%v", name, b, err)
+		}
+	}
+}
+
+func TestReloadRemoveFile(t *testing.T) {
+	dir := t.TempDir()
+	file := "[daily_file]\nfilePath=" + filepath.Join(dir, "removed.log") + "\nlog_iocache_size=0\n"
+	root := "[log4go]\nrootLogger=INFO,DAILY_ROLLING_FILE\n"
+	cfg := initTestConfig(t, dir, file+root)
+	logex := New("remove_file")
+	for _, content := range []string{root, "[daily_file]\nfilePath=\n" + root} {
+		ioutil.WriteFile(cfg, []byte(file+root), 0644)
+		InitConfig(cfg)
+		ioutil.WriteFile(cfg, []byte(content), 0644)
+		InitConfig(cfg)
+		if s := logex.settings(); s.Flag&Lfilexport != 0 || len(s.Outputs()) != 0 {
+			t.Fatalf("log file still configured:%s", s)
+		}
+	}
+}
+
+func TestReloadConcurrent(t *testing.T) {
+	dir := t.TempDir()
+	content := func(i int) string {
+		return `[daily_file]
+filePath=` + filepath.Join(dir, fmt.Sprintf("r%d.log", i)) + `
+log_iocache_size=0
+[log4go]
+rootLogger=INFO,DAILY_ROLLING_FILE
+`
+	}
+	cfg := initTestConfig(t, dir, content(0))
+	logex := New("reload_concurrent")
+	stop := make(chan struct{})
+	var wg sync.WaitGroup
+	var sent int64
+	for i := 0; i < 8; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for {
+				select {
+				case <-stop:
+					return
+				default:
+					logex.Infof("concurrent reload")
+					atomic.AddInt64(&sent, 1)
+				}
+			}
+		}()
+	}
+	for i := 1; i <= 40; i++ {
+		ioutil.WriteFile(cfg, []byte(content(i)), 0644)
+		InitConfig(cfg)
+	}
+	close(stop)
+	wg.Wait()
+	Close()
+	files, _ := filepath.Glob(filepath.Join(dir, "r*_*.log"))
+	var n int64
+	for _, f := range files {
+		b, _ := ioutil.ReadFile(f)
+		n += int64(strings.Count(string(b), "concurrent reload"))
+	}
+	if n != sent {
+		t.Fatalf("lost %d of %d records", sent-n, sent)
+	}
+}
+
+func TestReloadReset(t *testing.T) {
+	cfg := initTestConfig(t, t.TempDir(), "[log4go]\nrootLogger=INFO,CONSOLE\n[logger]\nreset=ERROR,DUMPSTACK\n")
+	logex := New("reset")
+	if logex.Level != LEVEL_ERROR || !logex.Trace || logex.Flag&Lconsole == 0 {
+		t.Fatalf("unexpected override:%s", logex.settings())
+	}
+	var changes []ConfigChange
+	SetReloadCallback(func(c []ConfigChange) { changes = c })
+	defer SetReloadCallback(nil)
+	ioutil.WriteFile(cfg, []byte("[log4go]\nrootLogger=INFO,CONSOLE\n"), 0644)
+	ReLoad()
+	if logex.Level != LEVEL_INFO || logex.Trace {
+		t.Fatalf("override not reset:%s", logex.settings())
+	}
+	for _, c := range changes {
+		if c.Name == "reset" && c.Old.Level == LEVEL_ERROR && c.New.Level == LEVEL_INFO {
+			return
+		}
+	}
+	t.Fatalf("change not reported:%v", changes)
+}
+
+func TestReloadUnchanged(t *testing.T) {
+	dir := t.TempDir()
+	initTestConfig(t, dir, "[log4go]\nrootLogger=INFO,CONSOLE,same_file\n[layout]\nsame=%p %m%n\n"+
+		"[appender.same_file]\nfilePath="+filepath.Join(dir, "same.log")+"\n[logger]\nsame=WARN,same\n")
+	Get("same")
+	var changes []ConfigChange
+	SetReloadCallback(func(c []ConfigChange) { changes = c })
+	defer SetReloadCallback(nil)
+	ReLoad()
+	if len(changes) != 0 {
+		t.Fatalf("unchanged reload reported changes:%v", changes)
+	}
+}
+
+func TestConcurrentLevel(t *testing.T) {
+	logex := Get("concurrent")
+	logex.apply(Settings{Level: LEVEL_INFO, Flag: Lfilexport, Out: ioutil.Discard})
+	var wg sync.WaitGroup
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		for i := 0; i < 1000; i++ {
+			logex.Infof("concurrent %d", i)
+		}
+	}()
+	for i := 0; i < 20; i++ {
+		if i%2 == 0 {
+			SetOutPutByName("concurrent", "WARN")
+		} else {
+			SetOutPutByName("concurrent", "DEBUG")
+		}
+	}
+	wg.Wait()
+}
+
+func TestHierarchy(t *testing.T) {
+	battle := New("game.battle.skill")
+	initTestConfig(t, t.TempDir(), "[log4go]\nrootLogger=INFO,CONSOLE\n[logger]\ngame=WARN,DUMPSTACK\ngame.battle=DEBUG\n")
+	chat := New("game.chat")
+	other := New("gamer")
+	if battle.Level != LEVEL_DEBUG || !battle.Trace || battle.Flag&Lconsole == 0 {
+		t.Fatalf("unexpected game.battle.skill:%s", battle.settings())
+	}
+	if chat.Level != LEVEL_WARN || !chat.Trace {
+		t.Fatalf("unexpected game.chat:%s", chat.settings())
+	}
+	if other.Level != LEVEL_INFO || other.Trace {
+		t.Fatalf("unexpected gamer:%s", other.settings())
+	}
+}
+
+func TestGet(t *testing.T) {
+	initTestConfig(t, t.TempDir(), "[log4go]\nrootLogger=INFO,CONSOLE\n[logger]\nplugin=ERROR\n")
+	if _, ok := Lookup("plugin"); ok {
+		t.Fatal("plugin logger exist before Get")
+	}
+	logex := Get("plugin")
+	if logex.Level != LEVEL_ERROR {
+		t.Fatalf("config not applied:%s", logex.settings())
+	}
+	if Get("plugin") != logex {
+		t.Fatal("Get returned a different logger")
+	}
+}
+
+func TestAdminHandler(t *testing.T) {
+	initTestConfig(t, t.TempDir(), "[log4go]\nrootLogger=INFO,CONSOLE\n[logger]\nadmin=WARN\n")
+	logex := Get("admin")
+	h := AdminHandler()
+	rec := httptest.NewRecorder()
+	h.ServeHTTP(rec, httptest.NewRequest("PUT", "/?name=admin&args=DEBUG&ttl=50ms", nil))
+	if rec.Code != http.StatusOK || logex.settings().Level != LEVEL_DEBUG {
+		t.Fatalf("update failed code:%d body:%s", rec.Code, rec.Body)
+	}
+	var info struct {
+		Loggers []LoggerInfo `json:"loggers"`
+	}
+	if err := json.Unmarshal(rec.Body.Bytes(), &info); err != nil {
+		t.Fatal(err)
+	}
+	rec = httptest.NewRecorder()
+	h.ServeHTTP(rec, httptest.NewRequest("PUT", "/?name=admin&args=NOPE", nil))
+	if rec.Code != http.StatusBadRequest {
+		t.Fatalf("invalid args code:%d", rec.Code)
+	}
+	rec = httptest.NewRecorder()
+	h.ServeHTTP(rec, httptest.NewRequest("PUT", "/?name=admin&args=DAILY_ROLLING_FILE(/tmp/x.log)", nil))
+	if rec.Code != http.StatusBadRequest {
+		t.Fatalf("file path accepted code:%d", rec.Code)
+	}
+	time.Sleep(200 * time.Millisecond)
+	if logex.settings().Level != LEVEL_WARN {
+		t.Fatalf("ttl not reverted:%s", logex.settings())
+	}
+}
+
+func TestSetLevelFor(t *testing.T) {
+	cfg := initTestConfig(t, t.TempDir(), "[log4go]\nrootLogger=INFO,CONSOLE\n[logger]\ntemp=WARN\n")
+	logex := Get("temp")
+	SetLevelFor("temp", LEVEL_DEBUG, 300*time.Millisecond)
+	if logex.settings().Level != LEVEL_DEBUG || Get("temp.sub").settings().Level != LEVEL_DEBUG {
+		t.Fatalf("temp level not applied:%s", logex.settings())
+	}
+	ioutil.WriteFile(cfg, []byte("[log4go]\nrootLogger=INFO,CONSOLE\n[logger]\ntemp=ERROR\n"), 0644)
+	InitConfig(cfg)
+	if logex.settings().Level != LEVEL_DEBUG {
+		t.Fatalf("temp level lost after reload:%s", logex.settings())
+	}
+	time.Sleep(500 * time.Millisecond)
+	if logex.settings().Level != LEVEL_ERROR || Get("temp.sub").settings().Level != LEVEL_ERROR {
+		t.Fatalf("temp level not expired:%s", logex.settings())
+	}
+}
+
+func TestStdLogger(t *testing.T) {
+	var buf bytes.Buffer
+	logex := &Logger{Name: "std", Level: LEVEL_WARN, Flag: Lshortfile | Lfilexport, Out: &buf}
+	std := logex.StdLogger(LEVEL_INFO)
+	std.Printf("hidden")
+	std.Println("[ERROR] boom")
+	w := logex.Writer(LEVEL_WARN)
+	fmt.Fprint(w, "WARNING: partial")
+	if strings.Contains(buf.String(), "partial") {
+		t.Fatal("partial line written before flush")
+	}
+	w.Flush()
+	out := buf.String()
+	if strings.Contains(out, "hidden") || strings.Count(out, "log_test.go:") != 2 {
+		t.Fatalf("unexpected output:%q", out)
+	}
+	if !strings.Contains(out, "ERROR") || !strings.Contains(out, "boom") || !strings.Contains(out, "WARN") || strings.Contains(out, "WARNING") {
+		t.Fatalf("level prefix not parsed:%q", out)
+	}
+}
+
+func TestRedirectStdLog(t *testing.T) {
+	initTestConfig(t, t.TempDir(), "[log4go]\nrootLogger=INFO,CONSOLE\n")
+	if stdLogWriter != nil {
+		t.Fatal("stdlib log redirected without log file")
+	}
+	var app, buf bytes.Buffer
+	log.SetOutput(&app)
+	log.SetPrefix("app: ")
+	defer func() {
+		log.SetOutput(os.Stderr)
+		log.SetPrefix("")
+		log.SetFlags(log.LstdFlags)
+	}()
+	logex := &Logger{Name: "stdlog", Level: LEVEL_INFO, Flag: Lfilexport, Out: &buf}
+	RedirectStdLog(logex, LEVEL_WARN)
+	log.Print("redirected")
+	NewGrpcLogger(logex, 0).Warning("grpc", "warning")
+	Close()
+	log.Print("restored")
+	if s := buf.String(); !strings.Contains(s, "redirected") || !strings.Contains(s, "grpcwarning") || strings.Contains(s, "restored") {
+		t.Fatalf("unexpected redirected output:%q", s)
+	}
+	if s := app.String(); !strings.Contains(s, "app: ") || !strings.Contains(s, "restored") || strings.Contains(s, "redirected") {
+		t.Fatalf("stdlib log not restored:%q", s)
+	}
+}
+
+func TestContext(t *testing.T) {
+	var buf bytes.Buffer
+	logex := &Logger{Name: "ctx", Level: LEVEL_INFO, Flag: Lfilexport, Out: &buf}
+	ctx := NewContext(context.Background(), "request_id", "r1")
+	ctx = NewContext(ctx, "player_id", 7)
+	if fields := FromContext(ctx); len(fields) != 2 || fields[0].Key != "request_id" {
+		t.Fatalf("unexpected fields:%v", fields)
+	}
+	logex.With("svc", "game").InfoCtx(ctx, "login %s", "ok")
+	logex.DebugCtx(ctx, "hidden")
+	out := buf.String()
+	if !strings.Contains(out, "login ok svc=game request_id=r1 player_id=7") || strings.Contains(out, "hidden") {
+		t.Fatalf("unexpected output:%q", out)
+	}
+}
+
+func TestSample(t *testing.T) {
+	var buf bytes.Buffer
+	logex := &Logger{Name: "sample"}
+	st := Settings{Level: LEVEL_INFO, Flag: Lfilexport, Out: &buf}
+	st.update("sample", "SAMPLE(2/1h/4)")
+	logex.apply(st)
+	for i := 0; i < 10; i++ {
+		logex.Warnf("hot loop %d", i)
+	}
+	logex.Infof("other")
+	logex.apply(Settings{Level: LEVEL_INFO, Flag: Lfilexport, Out: &buf})
+	out := buf.String()
+	for _, s := range []string{"hot loop 0", "hot loop 1", "hot loop 5", "hot loop 9", "other", "suppressed 6 records"} {
+		if !strings.Contains(out, s) {
+			t.Fatalf("missing %q in %q", s, out)
+		}
+	}
+	if strings.Count(out, "hot loop") != 4 {
+		t.Fatalf("unexpected output:%q", out)
+	}
+	buf.Reset()
+	st.Sample = SampleConfig{}
+	st.update("sample", "RATE(3/1h/caller)")
+	logex.apply(st)
+	for i := 0; i < 5; i++ {
+		logex.Warnf("rate %d", i)
+	}
+	if n := strings.Count(buf.String(), "rate"); n != 3 {
+		t.Fatalf("rate limit passed %d records", n)
+	}
+	buf.Reset()
+	st.Sample = SampleConfig{}
+	st.update("sample", "RATE(1/1h)")
+	logex.apply(st)
+	logex.Warnln("disk full")
+	logex.Warnln("db timeout")
+	if s := buf.String(); !strings.Contains(s, "disk full") || !strings.Contains(s, "db timeout") {
+		t.Fatalf("unformatted records share one key:%q", s)
+	}
+	buf.Reset()
+	std := logex.StdLogger(LEVEL_WARN)
+	for i := 0; i < 3; i++ {
+		std.Printf("std %d", i)
+	}
+	if n := strings.Count(buf.String(), "std"); n != 1 {
+		t.Fatalf("rate limit passed %d stdlib records", n)
+	}
+	if s := logex.settings().Sample.String(); s != "RATE(1/1h0m0s)" {
+		t.Fatalf("unexpected sample config:%s", s)
+	}
+	logex.apply(Settings{})
+}
+
+func TestDedup(t *testing.T) {
+	var buf bytes.Buffer
+	logex := &Logger{Name: "dedup"}
+	st := Settings{Level: LEVEL_INFO, Flag: Lfilexport | Lshortfile, Out: &buf}
+	st.update("dedup", "DEDUP(1s)")
+	logex.apply(st)
+	for i := 0; i < 5; i++ {
+		logex.Errorf("disk full")
+	}
+	for i := 0; i < 3; i++ {
+		logex.Errorf("disk ok")
+	}
+	logex.mu.Lock()
+	out := buf.String()
+	logex.mu.Unlock()
+	if strings.Count(out, "disk full") != 1 || !strings.Contains(out, "last message repeated 4 times") || strings.Count(out, "disk ok") != 1 {
+		t.Fatalf("unexpected output:%q", out)
+	}
+	time.Sleep(1500 * time.Millisecond)
+	logex.mu.Lock()
+	out = buf.String()
+	logex.mu.Unlock()
+	if !strings.Contains(out, "last message repeated 2 times") {
+		t.Fatalf("repeat not flushed after timeout:%q", out)
+	}
+	for i := 0; i < 2; i++ {
+		logex.Errorf("disk ok")
+	}
+	for i := 0; i < 3; i++ {
+		logex.Logf("player 7 bought sword")
+	}
+	if n := strings.Count(buf.String(), "player 7 bought sword"); n != 3 {
+		t.Fatalf("oplog records deduplicated:%d", n)
+	}
+	var next bytes.Buffer
+	st.Out = &next
+	logex.apply(st)
+	if !strings.Contains(buf.String(), "last message repeated 1 times") || next.Len() != 0 {
+		t.Fatalf("repeat not flushed to old output:%q %q", buf.String(), next.String())
+	}
+	logex.apply(Settings{})
+}
+
 func BenchmarkWrite(b *testing.B) {
 	InitConfig("./log4go.cfg")
 	for i := 0; i < b.N; i++ {
@@ -7,12 +7,13 @@ package golog
 import (
 	"fmt"
 	"io"
-	"log"
 	"os"
 	"path"
 	"path/filepath"
+	"strconv"
 	"strings"
 	"sync"
+	"sync/atomic"
 	"time"
 
 	"runtime/debug"
@@ -34,9 +35,29 @@ var (
 	LstaticLevel LogLevel = LEVEL_DEBUG
 	//全局输出流
 	LstaticIo io.Writer = defaultWriter
-	wc        io.WriteCloser
-	mu        sync.Mutex
-	cfgPath   string
+	//全局格式化器,为空时使用 DefaultFormatter
+	LstaticFormatter Formatter
+	//全局额外输出目标
+	LstaticAppenders []Appender
+	//全局采样及限流配置
+	LstaticSample SampleConfig
+	//全局重复消息合并的最长等待时间,为 0 时不合并
+	LstaticDedup time.Duration
+	wc           io.WriteCloser
+	mu           sync.Mutex
+	cfgPath      string
+	//[daily_file]日志文件配置
+	dailyCfg RotateConfig
+	//当前日志文件写入器 wc 的配置
+	wcCfg RotateConfig
+	//当前日志文件写入器 wc,供不持有 mu 时判断记录器的输出方式
+	curWriter atomic.Value
+	//[file.记录器名称]记录器单独的日志文件配置
+	fileSections = make(map[string]RotateConfig)
+	//记录器单独的日志文件,key 为文件路径
+	files      = make(map[string]*loggerFile)
+	fileGen    int
+	staleFiles []io.WriteCloser
 )
 
 //TimeoutWarning tag、detailed 表示超时发生位置的两个字符串参数，start 程序开始执行的时间，timeLimit  函数执行超时阀值，单位是秒。
@@ -62,10 +83,21 @@ func fieldEnv(cfg *config.Config, section, option string) {
 }
 
 func initWriter(cfg *config.Config, logCfgPath string) {
-	if wc != nil {
+	cfgPath = logCfgPath
+	dailyCfg = RotateConfig{CacheSize: LOG_WRITE_CACHE_SIZE}
+	if !cfg.HasSection("daily_file") {
+		retireWriter()
+		return
+	}
+	rc, err := parseRotateConfig(cfg, "daily_file", dailyCfg)
+	if err != nil {
+		Warnf("log file config err:%s", err)
+		return
+	}
+	dailyCfg = rc
+	if wc != nil && rc == wcCfg {
 		return
 	}
-	cfgPath = logCfgPath
 	//解析系统环境变量
 	//	if options, _ := cfg.SectionOptions(config.DEFAULT_SECTION); options != nil {
 	//		for _, env := range options {
@@ -74,26 +106,296 @@ func initWriter(cfg *config.Config, logCfgPath string) {
 	//	}
 	// 0 :解析日志输出文件
 	//	[daily_file]filePath=./test.daily.log
-	log_iocache_size, err := cfg.Int("daily_file", "log_iocache_size")
+	Infof("log4go file path=%s", rc.FilePath)
+	if len(rc.FilePath) > 0 {
+		w, err := NewRotate(rc)
+		if err != nil {
+			Warnf("log file path err:%s", err)
+			return
+		}
+		if wc != nil {
+			//配置变化,替换旧的日志文件写入器,旧写入器在本次配置应用完成后刷新并关闭
+			replaceWriter(wc, w)
+			staleFiles = append(staleFiles, wc)
+		}
+		setWriter(w, rc)
+		if stdLogWriter == nil {
+			//配置了日志文件时标准库 log 包的输出同样遵循日志配置
+			redirectStdLog(Trace, LEVEL_INFO)
+		}
+	} else {
+		retireWriter()
+	}
+}
+
+//retireWriter 配置中移除了日志文件时停用当前日志文件写入器,旧写入器在本次配置应用完成后刷新并关闭
+func retireWriter() {
+	if wc == nil {
+		return
+	}
+	staleFiles = append(staleFiles, wc)
+	setWriter(nil, RotateConfig{})
+}
+
+//writerRef 包装日志文件写入器,使 curWriter 可以保存空值
+type writerRef struct {
+	w io.Writer
+}
+
+//setWriter 设置当前日志文件写入器及其配置,调用时需持有 mu
+func setWriter(w io.WriteCloser, rc RotateConfig) {
+	wc, wcCfg = w, rc
+	curWriter.Store(writerRef{w})
+}
+
+//isDailyWriter 判断 w 是否为当前[daily_file]日志文件写入器,不需要持有 mu
+func isDailyWriter(w io.Writer) bool {
+	ref, _ := curWriter.Load().(writerRef)
+	return ref.w != nil && ref.w == w
+}
+
+//replaceWriter 将所有记录器中的输出流 old 替换为 w
+func replaceWriter(old io.Writer, w io.Writer) {
+	for _, logger := range logMap {
+		logger.mu.Lock()
+		if logger.Out == old {
+			logger.Out = w
+		}
+		logger.mu.Unlock()
+	}
+	if LstaticIo == old {
+		LstaticIo = w
+	}
+}
+
+//parseRotateConfig 解析日志文件滚动配置,未配置的项使用 rc 中的值
+//eg: [daily_file]filePath=./test.daily.log rotate=hourly log_iocache_size=4096 max_size=512MB max_days=30
+func parseRotateConfig(cfg *config.Config, section string, rc RotateConfig) (RotateConfig, error) {
+	var err error
+	if v, e := cfg.String(section, "filePath"); e == nil {
+		rc.FilePath = v
+	} else if rc.FilePath == "" {
+		return rc, e
+	}
+	if v, e := cfg.Int(section, "log_iocache_size"); e == nil {
+		rc.CacheSize = v
+	}
+	if v, e := cfg.String(section, "flush_interval"); e == nil {
+		if v = strings.TrimSpace(v); v == "" {
+			rc.FlushInterval = 0
+		} else if rc.FlushInterval, err = time.ParseDuration(v); err != nil {
+			return rc, err
+		}
+	}
+	if v, e := cfg.String(section, "flush_level"); e == nil && strings.TrimSpace(v) != "" {
+		if rc.FlushLevel, rc.FlushOnLevel = parseLevel(v); !rc.FlushOnLevel {
+			Warnf("[%s] flush_level=%s err", section, v)
+		}
+	}
+	if v, e := cfg.String(section, "rotate"); e == nil {
+		if _, e = parseRotatePeriod(v); e != nil {
+			Warnf("[%s] rotate=%s err:%v,use daily", section, v, e)
+		} else {
+			rc.Rotate = v
+		}
+	}
+	if v, e := cfg.String(section, "max_size"); e == nil {
+		if rc.MaxSize, err = parseSize(v); err != nil {
+			return rc, err
+		}
+	}
+	if v, e := cfg.Int(section, "max_days"); e == nil {
+		rc.MaxDays = v
+	}
+	if v, e := cfg.Int(section, "max_files"); e == nil {
+		rc.MaxFiles = v
+	}
+	if v, e := cfg.String(section, "max_total_size"); e == nil {
+		if rc.MaxTotalSize, err = parseSize(v); err != nil {
+			return rc, err
+		}
+	}
+	if v, e := cfg.Bool(section, "symlink"); e == nil {
+		rc.DisableSymlink = !v
+	}
+	if v, e := cfg.String(section, "compress"); e == nil {
+		switch v = strings.ToLower(strings.TrimSpace(v)); v {
+		case "", "none":
+			rc.Compress = ""
+		case "gzip", "gz":
+			rc.Compress = CompressGzip
+		default:
+			Warnf("[%s] compress=%s not supported,only gzip", section, v)
+		}
+	}
+	return rc, nil
+}
+
+//initLoggerFile 解析记录器单独的日志文件配置 [file.记录器名称],未配置的项使用[daily_file]中的值
+//eg: [file.test1]filePath=./log/test1.log ==> [logger]test1=INFO,DAILY_ROLLING_FILE
+func initLoggerFile(cfg *config.Config) {
+	fileSections = make(map[string]RotateConfig)
+	for _, section := range cfg.Sections() {
+		if !strings.HasPrefix(section, "file.") {
+			continue
+		}
+		rc, err := parseRotateConfig(cfg, section, dailyCfg)
+		if err != nil {
+			Warnf("[%s] err:%v", section, err)
+			continue
+		}
+		fileSections[strings.TrimPrefix(section, "file.")] = rc
+	}
+}
+
+//loggerFile 记录器单独的日志文件
+type loggerFile struct {
+	rc  RotateConfig
+	w   *DailyRotate
+	gen int //最后一次被引用时的配置版本
+}
+
+//openLoggerFile 打开或复用记录器单独的日志文件,同一路径的记录器共用一个文件
+func openLoggerFile(rc RotateConfig) (io.WriteCloser, error) {
+	key := fileutil.TransPath(rc.FilePath)
+	if lf, ok := files[key]; ok && lf.rc == rc {
+		lf.gen = fileGen
+		return lf.w, nil
+	}
+	w, err := NewRotate(rc)
 	if err != nil {
-		log_iocache_size = LOG_WRITE_CACHE_SIZE
+		return nil, err
 	}
-	filePath, err := cfg.String("daily_file", "filePath")
-	if err == nil {
-		Infof("log4go file path=%s", filePath)
-		if len(filePath) > 0 {
-			if wc, err = NewDailyRotate(filePath, log_iocache_size); err != nil {
-				Warnf("log file path err:%s", err)
-			} else {
-				log.SetOutput(wc)
+	if lf, ok := files[key]; ok {
+		//配置变化,旧文件在本次配置应用完成后关闭
+		staleFiles = append(staleFiles, lf.w)
+	}
+	files[key] = &loggerFile{rc: rc, w: w, gen: fileGen}
+	return w, nil
+}
+
+//closeStaleFiles 关闭本次配置中不再被引用的日志文件
+func closeStaleFiles() {
+	for key, lf := range files {
+		if lf.gen != fileGen {
+			staleFiles = append(staleFiles, lf.w)
+			delete(files, key)
+		}
+	}
+	if len(staleFiles) == 0 {
+		return
+	}
+	flushAsync()
+	for _, w := range staleFiles {
+		w.Close()
+	}
+	staleFiles = nil
+}
+
+//parseFileArg 解析带参数的输出类型 eg:DAILY_ROLLING_FILE(./log/test1.log) ==> DAILY_ROLLING_FILE ./log/test1.log
+func parseFileArg(arg string) (string, string) {
+	if i := strings.IndexByte(arg, '('); i > 0 && strings.HasSuffix(arg, ")") {
+		return strings.ToUpper(strings.TrimSpace(arg[:i])), strings.TrimSpace(arg[i+1 : len(arg)-1])
+	}
+	return strings.ToUpper(arg), ""
+}
+
+//parseSize 解析字节大小,支持 B、K(KB)、M(MB)、G(GB) 单位 eg:512MB
+func parseSize(s string) (int64, error) {
+	s = strings.ToUpper(strings.TrimSpace(s))
+	unit := int64(1)
+	for _, u := range []struct {
+		suffix string
+		size   int64
+	}{{"KB", 1 << 10}, {"MB", 1 << 20}, {"GB", 1 << 30}, {"K", 1 << 10}, {"M", 1 << 20}, {"G", 1 << 30}, {"B", 1}} {
+		if strings.HasSuffix(s, u.suffix) {
+			s = strings.TrimSpace(strings.TrimSuffix(s, u.suffix))
+			unit = u.size
+			break
+		}
+	}
+	n, err := strconv.ParseInt(s, 10, 64)
+	if err != nil || n < 0 {
+		return 0, fmt.Errorf("invalid size %q", s)
+	}
+	return n * unit, nil
+}
+
+//initLayout 解析转换模式格式,注册为同名格式化器
+//eg: [layout]simple=%d{2006-01-02 15:04:05.000} %-5p [%c] %F:%L - %m%n
+func initLayout(cfg *config.Config) {
+	options, err := cfg.SectionOptions("layout")
+	if err != nil {
+		return
+	}
+	for _, name := range options {
+		pattern, err := cfg.String("layout", name)
+		if err != nil {
+			Warnf("layout[%s] propery err:%v", name, err)
+			continue
+		}
+		if o, ok := GetFormatter(name); ok {
+			if p, ok := o.(*PatternFormatter); ok && p.pattern == pattern {
+				//模式未变化时保留原有格式化器,重新加载时记录器配置不视为变化
+				continue
 			}
 		}
+		f, err := NewPatternFormatter(pattern)
+		if err != nil {
+			Warnf("layout[%s] pattern err:%v", name, err)
+			continue
+		}
+		RegisterFormatter(name, f)
 	}
 }
 
+//initAsync 解析异步输出队列配置
+//eg: [async]queue_size=8192 overflow=drop_level drop_level=WARN
+func initAsync(cfg *config.Config) {
+	if !cfg.HasSection("async") {
+		return
+	}
+	size, err := cfg.Int("async", "queue_size")
+	if err != nil {
+		size = ASYNC_QUEUE_SIZE
+	}
+	overflow := OverflowBlock
+	if v, err := cfg.String("async", "overflow"); err == nil {
+		if overflow, err = ParseAsyncOverflow(v); err != nil {
+			Warnf("[async] overflow err:%v", err)
+		}
+	}
+	dropLevel := LEVEL_WARN
+	if v, err := cfg.String("async", "drop_level"); err == nil {
+		if lv, ok := parseLevel(v); ok {
+			dropLevel = lv
+		} else {
+			Warnf("[async] drop_level=%s err", v)
+		}
+	}
+	SetAsync(size, overflow, dropLevel)
+}
+
+//parseLevel 解析日志等级名称 DEBUG、INFO、WARN、ERROR、FATAL
+func parseLevel(s string) (LogLevel, bool) {
+	s = strings.ToUpper(strings.TrimSpace(s))
+	for i, name := range levelNames[:LEVEL_LOG] {
+		if name == s {
+			return LogLevel(i), true
+		}
+	}
+	return LEVEL_DEBUG, false
+}
+
 //ReLoad 重新读取日志配置文件进行输出更新
 func ReLoad() {
-	InitConfig(cfgPath)
+	mu.Lock()
+	path := cfgPath
+	mu.Unlock()
+	if path == "" {
+		return
+	}
+	InitConfig(path)
 }
 
 //InitConfig 初始化或更新日志文件信息
@@ -108,37 +410,55 @@ func InitConfig(configurl string) {
 	if err != nil {
 		panic(fmt.Errorf("加载日志文件配置表[%s]错误,error=%v", configurl, err))
 	}
+	var changes []ConfigChange
+	var callback func([]ConfigChange)
+	defer func() {
+		//释放锁后回调,回调中可以输出日志或修改配置
+		if callback != nil && len(changes) > 0 {
+			callback(changes)
+		}
+	}()
 	mu.Lock()
 	defer mu.Unlock()
+	fileGen++
+	defer closeStaleFiles()
 	initWriter(cfg, configurl)
-	// 1 解析日志全局输出方式
+	initLoggerFile(cfg)
+	initLayout(cfg)
+	initAsync(cfg)
+	initOpLog(cfg)
+	initWatch(cfg, configurl)
+	olds := initAppender(cfg)
+	defer func() {
+		//替换后的旧输出目标在写完队列中的记录后关闭
+		if len(olds) > 0 {
+			flushAsync()
+			for _, a := range olds {
+				a.Close()
+			}
+		}
+	}()
+	// 1 解析日志全局输出方式,每次加载都从默认配置开始重新计算
 	//日志全局参数设置 eg: [log4go]rootLogger=WARN,CONSOLE,DAILY_ROLLING_FILE
+	root := defaultSettings()
 	args, err := cfg.String("log4go", "rootLogger")
 	if err == nil {
 		if len(args) > 0 {
 			types := strings.Split(args, ",")
 			Infof("Logger [log4go] rootLogger:%+v", types)
-			LstaticStdFlags = LstdFlags
+			root = Settings{Level: LEVEL_DEBUG, Flag: LstdFlags, Out: defaultWriter}
 			for _, arg := range types {
-				arg = strings.TrimSpace(arg)
-				updateGlobalOutPut(arg)
-			}
-			for _, logger := range logMap {
-				if LstaticStdFlags&Lfilexport != 0 {
-					if wc != nil {
-						logger.Out = wc
-					}
-				}
-				logger.Flag = LstaticStdFlags
-				logger.Level = LstaticLevel
-				logger.Trace = DUMPSTACK_OPEN
+				root.update("", strings.TrimSpace(arg))
 			}
 		}
 	} else {
 		Warnf("Logger [log4go] rootLogger err:%v", err)
 	}
-	// 2 解析日志详细输出方式
+	setRoot(root)
+	configRoot = root
+	// 2 解析日志详细输出方式,在全局配置的基础上覆盖
 	// eg: [logger]test=INFO,CONSOLE,DAILY_ROLLING_FILE,DUMPSTACK
+	overrides = make(map[string][]string)
 	if options, err := cfg.SectionOptions("logger"); err == nil && options != nil {
 		for _, name := range options {
 			args, err = cfg.String("logger", name)
@@ -146,24 +466,24 @@ func InitConfig(configurl string) {
 				Warnf("logger[%s] propery err:%v", name, err)
 				continue
 			}
-			logger, ok := logMap[name]
-			if !ok {
-				continue
-			}
 			args = strings.TrimSpace(args)
 			if len(args) > 0 {
 				types := strings.Split(args, ",")
-				Infof("Logger[%s] setting:%+v", name, types)
-				//重置输出标记
-				logger.Flag = LstdFlags
-				for _, arg := range types {
-					updateOutPut(logger, strings.TrimSpace(arg))
+				for i := range types {
+					types[i] = strings.TrimSpace(types[i])
 				}
+				Infof("Logger[%s] setting:%+v", name, types)
+				overrides[name] = types
 			}
 		}
 	} else {
 		Infof("Logger [logger] err:%v", err)
 	}
+	// 3 解析临时等级配置,未到期的临时等级在重新加载后继续生效
+	initTempLevel(cfg)
+	// 4 计算所有记录器的生效配置并应用
+	changes = applyConfig()
+	callback = reloadCallback
 }
 
 func add(name string) *Logger {
@@ -173,63 +493,45 @@ func add(name string) *Logger {
 		fmt.Printf("Add Logger Error,contain Logger,name=[%s]\n", name)
 		return ol
 	}
-	logger := &Logger{Out: LstaticIo, Flag: LstaticStdFlags, Level: LstaticLevel, Name: name, Trace: DUMPSTACK_OPEN}
+	return addLocked(name)
+}
+
+//Get 根据名称获取记录器,不存在时创建,创建时应用已加载的全局及[logger]配置
+func Get(name string) *Logger {
+	mu.Lock()
+	defer mu.Unlock()
+	if ol, ok := logMap[name]; ok {
+		return ol
+	}
+	return addLocked(name)
+}
+
+//Lookup 根据名称查找已存在的记录器
+func Lookup(name string) (*Logger, bool) {
+	mu.Lock()
+	defer mu.Unlock()
+	l, ok := logMap[name]
+	return l, ok
+}
+
+func addLocked(name string) *Logger {
+	//应用全局配置及[logger]中该记录器和上级记录器的配置
+	logger := &Logger{Name: name}
+	logger.apply(effectiveSettings(name))
 	logMap[logger.Name] = logger
 	return logger
 }
 func updateGlobalOutPut(arg string) {
-	arg = strings.ToUpper(arg)
-	switch arg {
-	case "CONSOLE":
-		LstaticStdFlags |= Lconsole
-	case "DAILY_ROLLING_FILE":
-		if wc != nil {
-			LstaticIo = wc
-			LstaticStdFlags |= Lfilexport
-		} else {
-			Infoln("config no set out file path.eg:[daily_file] filePath=./test.daily.log")
-		}
-	case "DEBUG":
-		LstaticLevel = LEVEL_DEBUG
-	case "INFO":
-		LstaticLevel = LEVEL_INFO
-	case "WARN":
-		LstaticLevel = LEVEL_WARN
-	case "ERROR":
-		LstaticLevel = LEVEL_ERROR
-	case "FATAL":
-		LstaticLevel = LEVEL_FATAL
-	case "DUMPSTACK":
-		DUMPSTACK_OPEN = true
-	}
+	root := rootSettings()
+	root.update("", arg)
+	setRoot(root)
 }
 
 //根据日志名称类型设置输出参数
 func updateOutPut(logger *Logger, arg string) {
-	arg = strings.ToUpper(arg)
-	switch arg {
-	case "CONSOLE":
-		logger.Flag |= Lconsole
-	case "DAILY_ROLLING_FILE":
-		if wc != nil {
-			logger.Out = wc
-			logger.Flag |= Lfilexport
-		} else {
-			Infoln("config no set out file path.eg:[daily_file] filePath=./test.daily.log")
-		}
-	case "DEBUG":
-		logger.Level = LEVEL_DEBUG
-	case "INFO":
-		logger.Level = LEVEL_INFO
-	case "WARN":
-		logger.Level = LEVEL_WARN
-	case "ERROR":
-		logger.Level = LEVEL_ERROR
-	case "FATAL":
-		logger.Level = LEVEL_FATAL
-	case "DUMPSTACK":
-		logger.Trace = true
-	}
+	s := logger.settings()
+	s.update(logger.Name, arg)
+	logger.apply(s)
 }
 
 //SetGlobalOutPut 设置全局输出参数
@@ -250,11 +552,55 @@ func SetOutPutByName(name string, arg string) {
 	updateOutPut(logger, arg)
 }
 
+//Flush 等待异步队列写出并将全部日志文件(包括记录器单独的日志文件、输出目标、操作日志)的缓存写入磁盘
+func Flush() {
+	flushAsync()
+	var ws []interface{}
+	mu.Lock()
+	ws = append(ws, wc)
+	for _, lf := range files {
+		ws = append(ws, lf.w)
+	}
+	mu.Unlock()
+	if h, _ := opLog.Load().(*opLogHolder); h != nil && h.a != nil {
+		ws = append(ws, h.a)
+	}
+	appenderMu.RLock()
+	for _, a := range appenders {
+		ws = append(ws, a)
+	}
+	appenderMu.RUnlock()
+	for _, w := range ws {
+		if f, ok := w.(flusher); ok {
+			f.Flush()
+		}
+	}
+}
+
+//flusher 可刷新缓存的输出流或输出目标
+type flusher interface {
+	Flush() error
+}
+
 //Close 关闭
 func Close() {
 	defer func() { recover() }()
+	stopWatch()
+	stopSamplers()
+	flushDedups()
+	closeAsync()
+	closeAppenders()
+	mu.Lock()
+	defer mu.Unlock()
+	closeOpLog()
+	for key, lf := range files {
+		lf.w.Close()
+		delete(files, key)
+	}
+	resetStdLog()
 	if wc != nil {
 		wc.Close()
+		setWriter(nil, RotateConfig{})
 	}
 }
 
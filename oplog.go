@@ -0,0 +1,97 @@
+// Copyright 2016 zxfonline@sina.com. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package golog
+
+import (
+	"strings"
+	"sync/atomic"
+
+	"github.com/zxfonline/config"
+)
+
+var (
+	//操作日志(LEVEL_LOG)专用输出目标
+	opLog atomic.Value //*opLogHolder
+	//操作日志配置,配置未变化时重新加载不替换输出目标
+	opLogCfg    RotateConfig
+	opLogFormat string
+)
+
+type opLogHolder struct {
+	a Appender
+}
+
+//SetOpLogAppender 设置操作日志(LEVEL_LOG)专用输出目标,设置后操作日志不再写入日志文件,a 为空时恢复默认输出,返回旧的输出目标
+func SetOpLogAppender(a Appender) Appender {
+	var old Appender
+	if h, _ := opLog.Load().(*opLogHolder); h != nil {
+		old = h.a
+	}
+	opLog.Store(&opLogHolder{a})
+	return old
+}
+
+//writeOpLog 将操作日志写入专用输出目标,未配置时返回 false
+func writeOpLog(r *Record) bool {
+	h, _ := opLog.Load().(*opLogHolder)
+	if h == nil || h.a == nil {
+		return false
+	}
+	h.a.Append(r)
+	return true
+}
+
+//initOpLog 解析操作日志专用输出配置,滚动、保留等配置项与[daily_file]相同,未配置的项使用[daily_file]中的值
+//eg: [oplog]filePath=./log/test.oplog.log format=JSON max_days=180
+func initOpLog(cfg *config.Config) {
+	if !cfg.HasSection("oplog") {
+		if old := SetOpLogAppender(nil); old != nil {
+			flushAsync()
+			old.Close()
+		}
+		opLogCfg, opLogFormat = RotateConfig{}, ""
+		return
+	}
+	base := dailyCfg
+	base.FilePath = ""
+	rc, err := parseRotateConfig(cfg, "oplog", base)
+	if err != nil {
+		Warnf("[oplog] err:%v", err)
+		return
+	}
+	format, _ := cfg.String("oplog", "format")
+	format = strings.ToUpper(strings.TrimSpace(format))
+	if h, _ := opLog.Load().(*opLogHolder); h != nil && h.a != nil && rc == opLogCfg && format == opLogFormat {
+		return
+	}
+	var formatter Formatter
+	if format != "" {
+		f, ok := GetFormatter(format)
+		if !ok {
+			Warnf("[oplog] format=%s not found", format)
+			return
+		}
+		formatter = f
+	}
+	w, err := NewRotate(rc)
+	if err != nil {
+		Warnf("[oplog] log file path err:%s", err)
+		return
+	}
+	Infof("log4go oplog file path=%s", rc.FilePath)
+	opLogCfg, opLogFormat = rc, format
+	if old := SetOpLogAppender(NewWriterAppender("oplog", w, LEVEL_LOG, formatter)); old != nil {
+		flushAsync()
+		old.Close()
+	}
+}
+
+//closeOpLog 关闭操作日志专用输出目标
+func closeOpLog() {
+	if old := SetOpLogAppender(nil); old != nil {
+		old.Close()
+	}
+	opLogCfg, opLogFormat = RotateConfig{}, ""
+}
@@ -0,0 +1,137 @@
+// Copyright 2016 zxfonline@sina.com. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package golog
+
+import (
+	"os"
+	"os/signal"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
+
+	"github.com/zxfonline/config"
+)
+
+var (
+	watchMu       sync.Mutex
+	watchStop     chan struct{}
+	watchInterval time.Duration
+	signalStop    chan struct{}
+	//最后一次加载的配置文件修改时间
+	cfgModTime time.Time
+)
+
+//initWatch 解析配置文件热加载配置
+//eg: [log4go]watch_interval=5s reload_signal=true
+func initWatch(cfg *config.Config, configurl string) {
+	if fi, err := os.Stat(configurl); err == nil {
+		watchMu.Lock()
+		cfgModTime = fi.ModTime()
+		watchMu.Unlock()
+	}
+	var interval time.Duration
+	if v, err := cfg.String("log4go", "watch_interval"); err == nil && strings.TrimSpace(v) != "" {
+		if interval, err = time.ParseDuration(strings.TrimSpace(v)); err != nil {
+			Warnf("[log4go] watch_interval=%s err:%v", v, err)
+		}
+	}
+	Watch(interval)
+	if v, err := cfg.Bool("log4go", "reload_signal"); err == nil && v {
+		WatchSignal()
+	} else {
+		StopWatchSignal()
+	}
+}
+
+//Watch 定时检查日志配置文件的修改时间,变化时重新加载配置,interval<=0 时停止检查
+func Watch(interval time.Duration) {
+	watchMu.Lock()
+	defer watchMu.Unlock()
+	if interval == watchInterval && (interval <= 0 || watchStop != nil) {
+		return
+	}
+	if watchStop != nil {
+		close(watchStop)
+		watchStop = nil
+	}
+	watchInterval = interval
+	if interval <= 0 {
+		return
+	}
+	watchStop = make(chan struct{})
+	go watch(interval, watchStop)
+}
+
+func watch(interval time.Duration, stop chan struct{}) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+			mu.Lock()
+			path := cfgPath
+			mu.Unlock()
+			if path == "" {
+				continue
+			}
+			fi, err := os.Stat(path)
+			if err != nil {
+				continue
+			}
+			watchMu.Lock()
+			changed := !fi.ModTime().Equal(cfgModTime)
+			//加载失败时同样记录修改时间,避免每次检查都重复加载错误的配置
+			cfgModTime = fi.ModTime()
+			watchMu.Unlock()
+			if changed {
+				Infof("log4go config [%s] changed,reload", path)
+				ReLoad()
+			}
+		case <-stop:
+			return
+		}
+	}
+}
+
+//WatchSignal 收到 SIGHUP 信号时重新加载日志配置
+func WatchSignal() {
+	watchMu.Lock()
+	defer watchMu.Unlock()
+	if signalStop != nil {
+		return
+	}
+	signalStop = make(chan struct{})
+	go func(stop chan struct{}) {
+		c := make(chan os.Signal, 1)
+		signal.Notify(c, syscall.SIGHUP)
+		defer signal.Stop(c)
+		for {
+			select {
+			case <-c:
+				Infof("log4go receive signal SIGHUP,reload")
+				ReLoad()
+			case <-stop:
+				return
+			}
+		}
+	}(signalStop)
+}
+
+//StopWatchSignal 停止监听 SIGHUP 信号
+func StopWatchSignal() {
+	watchMu.Lock()
+	defer watchMu.Unlock()
+	if signalStop != nil {
+		close(signalStop)
+		signalStop = nil
+	}
+}
+
+//stopWatch 停止配置文件热加载
+func stopWatch() {
+	Watch(0)
+	StopWatchSignal()
+}
@@ -0,0 +1,303 @@
+// Copyright 2016 zxfonline@sina.com. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package golog
+
+import (
+	"fmt"
+	"runtime"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+//SampleConfig 记录器的采样及限流配置,零值表示不采样不限流
+type SampleConfig struct {
+	//First 每个周期内每个键值前 First 条记录全部输出
+	First int
+	//Interval 采样周期
+	Interval time.Duration
+	//Thereafter 超过 First 条后每 Thereafter 条输出一条,为 0 时全部丢弃
+	Thereafter int
+	//Rate 令牌桶限流,每个 RateInterval 最多输出 Rate 条
+	Rate         int
+	RateInterval time.Duration
+	//ByCaller 按调用位置区分键值,否则按等级+格式化字符串区分(格式化字符串为空或"%s"时按调用位置区分)
+	ByCaller bool
+}
+
+//Enabled 是否开启采样或限流
+func (c SampleConfig) Enabled() bool {
+	return c.Interval > 0 || c.RateInterval > 0
+}
+
+//String 配置描述 eg:SAMPLE(100/1s/10),RATE(50/1s)
+func (c SampleConfig) String() string {
+	var args []string
+	suffix := ""
+	if c.ByCaller {
+		suffix = "/caller"
+	}
+	if c.Interval > 0 {
+		arg := fmt.Sprintf("SAMPLE(%d/%s", c.First, c.Interval)
+		if c.Thereafter > 0 {
+			arg += "/" + strconv.Itoa(c.Thereafter)
+		}
+		args = append(args, arg+suffix+")")
+	}
+	if c.RateInterval > 0 {
+		args = append(args, fmt.Sprintf("RATE(%d/%s%s)", c.Rate, c.RateInterval, suffix))
+	}
+	return strings.Join(args, ",")
+}
+
+//parseSample 解析采样参数 first/interval[/thereafter][/caller] eg:100/1s 100/1s/10/caller,off 表示关闭
+func (c *SampleConfig) parseSample(param string) error {
+	if strings.EqualFold(param, "off") {
+		c.First, c.Interval, c.Thereafter = 0, 0, 0
+		return nil
+	}
+	parts, byCaller := splitSampleParam(param)
+	if len(parts) < 2 || len(parts) > 3 {
+		return fmt.Errorf("invalid SAMPLE(%s),eg:SAMPLE(100/1s/10)", param)
+	}
+	first, err := strconv.Atoi(parts[0])
+	if err != nil || first < 0 {
+		return fmt.Errorf("invalid SAMPLE(%s) first", param)
+	}
+	interval, err := time.ParseDuration(parts[1])
+	if err != nil || interval <= 0 {
+		return fmt.Errorf("invalid SAMPLE(%s) interval", param)
+	}
+	thereafter := 0
+	if len(parts) == 3 {
+		if thereafter, err = strconv.Atoi(parts[2]); err != nil || thereafter < 0 {
+			return fmt.Errorf("invalid SAMPLE(%s) thereafter", param)
+		}
+	}
+	c.First, c.Interval, c.Thereafter = first, interval, thereafter
+	c.ByCaller = c.ByCaller || byCaller
+	return nil
+}
+
+//parseRate 解析限流参数 n/interval[/caller] eg:50/1s,off 表示关闭
+func (c *SampleConfig) parseRate(param string) error {
+	if strings.EqualFold(param, "off") {
+		c.Rate, c.RateInterval = 0, 0
+		return nil
+	}
+	parts, byCaller := splitSampleParam(param)
+	if len(parts) != 2 {
+		return fmt.Errorf("invalid RATE(%s),eg:RATE(50/1s)", param)
+	}
+	rate, err := strconv.Atoi(parts[0])
+	if err != nil || rate <= 0 {
+		return fmt.Errorf("invalid RATE(%s) rate", param)
+	}
+	interval, err := time.ParseDuration(parts[1])
+	if err != nil || interval <= 0 {
+		return fmt.Errorf("invalid RATE(%s) interval", param)
+	}
+	c.Rate, c.RateInterval = rate, interval
+	c.ByCaller = c.ByCaller || byCaller
+	return nil
+}
+
+func splitSampleParam(param string) ([]string, bool) {
+	parts := strings.Split(param, "/")
+	for i := range parts {
+		parts[i] = strings.TrimSpace(parts[i])
+	}
+	if n := len(parts); n > 0 && strings.EqualFold(parts[n-1], "caller") {
+		return parts[:n-1], true
+	}
+	return parts, false
+}
+
+type sampleKey struct {
+	level  LogLevel
+	format string
+	pc     uintptr
+}
+
+type sampleEntry struct {
+	start  time.Time //当前采样周期开始时间
+	count  int       //当前采样周期内的记录数
+	tokens float64   //令牌桶中的令牌数
+	last   time.Time //最后一条记录的时间
+}
+
+//sampler 记录器的采样器,定时输出被丢弃记录数的汇总
+type sampler struct {
+	l          *Logger
+	cfg        SampleConfig
+	mu         sync.Mutex
+	entries    map[sampleKey]*sampleEntry
+	suppressed int
+	maxLevel   LogLevel //被丢弃记录的最高等级,汇总记录使用该等级输出
+	stop       chan struct{}
+	done       chan struct{}
+}
+
+func newSampler(l *Logger, cfg SampleConfig) *sampler {
+	s := &sampler{
+		l:       l,
+		cfg:     cfg,
+		entries: make(map[sampleKey]*sampleEntry),
+		stop:    make(chan struct{}),
+		done:    make(chan struct{}),
+	}
+	go s.run()
+	return s
+}
+
+//period 汇总及清理周期,不小于 1 秒
+func (s *sampler) period() time.Duration {
+	d := s.cfg.Interval
+	if s.cfg.RateInterval > d {
+		d = s.cfg.RateInterval
+	}
+	if d < time.Second {
+		d = time.Second
+	}
+	return d
+}
+
+func (s *sampler) run() {
+	defer close(s.done)
+	period := s.period()
+	ticker := time.NewTicker(period)
+	defer ticker.Stop()
+	for {
+		select {
+		case now := <-ticker.C:
+			s.summary(now, period)
+		case <-s.stop:
+			s.summary(time.Now(), 0)
+			return
+		}
+	}
+}
+
+//summary 输出被丢弃记录数的汇总,并清理不活跃的键值
+func (s *sampler) summary(now time.Time, period time.Duration) {
+	s.mu.Lock()
+	n, level := s.suppressed, s.maxLevel
+	s.suppressed, s.maxLevel = 0, LEVEL_DEBUG
+	if period > 0 {
+		for k, e := range s.entries {
+			if now.Sub(e.last) > 2*period {
+				delete(s.entries, k)
+			}
+		}
+	}
+	s.mu.Unlock()
+	if n > 0 {
+		s.l.outputAt(now, level, 0, 0, "log sampling suppressed "+strconv.Itoa(n)+" records",
+			[]Field{{Key: "suppressed", Value: n}, {Key: "sample", Value: s.cfg.String()}})
+	}
+}
+
+//close 停止采样器并输出剩余的汇总
+func (s *sampler) close() {
+	close(s.stop)
+	<-s.done
+}
+
+//allow 判断记录是否输出,调用位置的参数与 outputAt 相同
+func (s *sampler) allow(level LogLevel, calldepth int, pc uintptr, format string) bool {
+	key := sampleKey{level: level}
+	//未使用格式化字符串时(*ln、"%s" 等)无法区分消息,按调用位置区分
+	if s.cfg.ByCaller || format == "" || format == "%s" {
+		switch {
+		case pc != 0:
+			key.pc = pc
+		case calldepth > 0:
+			key.pc, _, _, _ = runtime.Caller(calldepth)
+		case calldepth == callerSearch:
+			key.pc = searchFrame(2).PC
+		}
+	} else {
+		key.format = format
+	}
+	now := time.Now()
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	e, ok := s.entries[key]
+	if !ok {
+		e = &sampleEntry{start: now, tokens: float64(s.cfg.Rate)}
+		s.entries[key] = e
+	}
+	allow := true
+	if s.cfg.Interval > 0 {
+		if now.Sub(e.start) >= s.cfg.Interval {
+			e.start, e.count = now, 0
+		}
+		e.count++
+		if n := e.count - s.cfg.First; n > 0 && (s.cfg.Thereafter == 0 || n%s.cfg.Thereafter != 0) {
+			allow = false
+		}
+	}
+	if allow && s.cfg.RateInterval > 0 {
+		if ok {
+			e.tokens += float64(now.Sub(e.last)) / float64(s.cfg.RateInterval) * float64(s.cfg.Rate)
+			if e.tokens > float64(s.cfg.Rate) {
+				e.tokens = float64(s.cfg.Rate)
+			}
+		}
+		if e.tokens >= 1 {
+			e.tokens--
+		} else {
+			allow = false
+		}
+	}
+	e.last = now
+	if !allow {
+		s.suppressed++
+		if level > s.maxLevel {
+			s.maxLevel = level
+		}
+	}
+	return allow
+}
+
+//sampled 记录是否被采样器丢弃,calldepth 与 output 相同
+func (l *Logger) sampled(level LogLevel, calldepth int, format string) bool {
+	return l.sampledAt(level, calldepth+1, 0, format)
+}
+
+//sampledAt 记录是否被采样器丢弃,调用位置的参数与 outputAt 相同,操作日志不参与采样
+func (l *Logger) sampledAt(level LogLevel, calldepth int, pc uintptr, format string) bool {
+	if level == LEVEL_LOG {
+		return false
+	}
+	b := l.base()
+	b.mu.Lock()
+	s := b.sampler
+	b.mu.Unlock()
+	if calldepth > 0 {
+		calldepth++
+	}
+	return s != nil && !s.allow(level, calldepth, pc, format)
+}
+
+//stopSamplers 停止所有记录器的采样器并输出剩余的汇总
+func stopSamplers() {
+	mu.Lock()
+	loggers := make([]*Logger, 0, len(logMap))
+	for _, logger := range logMap {
+		loggers = append(loggers, logger)
+	}
+	mu.Unlock()
+	for _, logger := range loggers {
+		logger.mu.Lock()
+		s := logger.sampler
+		logger.sampler = nil
+		logger.mu.Unlock()
+		if s != nil {
+			s.close()
+		}
+	}
+}
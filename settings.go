@@ -0,0 +1,360 @@
+// Copyright 2016 zxfonline@sina.com. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package golog
+
+import (
+	"fmt"
+	"io"
+	"reflect"
+	"sort"
+	"strings"
+	"sync/atomic"
+	"time"
+)
+
+//Settings 记录器的生效配置
+type Settings struct {
+	Level     LogLevel
+	Flag      int
+	Trace     bool
+	Out       io.Writer
+	Formatter Formatter
+	Appenders []Appender
+	Sample    SampleConfig
+	Dedup     time.Duration
+}
+
+//ConfigChange 重新加载配置时记录器生效配置的变化
+type ConfigChange struct {
+	Name string
+	Old  Settings
+	New  Settings
+}
+
+func (c ConfigChange) String() string {
+	return fmt.Sprintf("logger[%s] %s ==> %s", c.Name, c.Old, c.New)
+}
+
+var (
+	//[logger]中配置的记录器输出参数,key 为记录器名称
+	overrides = make(map[string][]string)
+	//重新加载配置后的回调
+	reloadCallback func(changes []ConfigChange)
+	//配置文件中的全局配置
+	configRoot = defaultSettings()
+)
+
+//SetReloadCallback 设置加载配置后的回调,参数为生效配置发生变化的记录器,按名称排序
+func SetReloadCallback(f func(changes []ConfigChange)) {
+	mu.Lock()
+	defer mu.Unlock()
+	reloadCallback = f
+}
+
+//defaultSettings 未配置 rootLogger 时的全局配置
+func defaultSettings() Settings {
+	return Settings{Level: LEVEL_DEBUG, Flag: LstdFlags | Lconsole, Out: defaultWriter}
+}
+
+//rootSettings 返回全局配置
+func rootSettings() Settings {
+	return Settings{
+		Level:     LstaticLevel,
+		Flag:      LstaticStdFlags,
+		Trace:     DUMPSTACK_OPEN,
+		Out:       LstaticIo,
+		Formatter: LstaticFormatter,
+		Appenders: LstaticAppenders,
+		Sample:    LstaticSample,
+		Dedup:     LstaticDedup,
+	}
+}
+
+//setRoot 设置全局配置
+func setRoot(s Settings) {
+	LstaticLevel = s.Level
+	LstaticStdFlags = s.Flag
+	DUMPSTACK_OPEN = s.Trace
+	LstaticIo = s.Out
+	LstaticFormatter = s.Formatter
+	LstaticAppenders = s.Appenders
+	LstaticSample = s.Sample
+	LstaticDedup = s.Dedup
+}
+
+//effectiveSettings 根据全局配置以及[logger]中的配置计算记录器的生效配置,
+//以"."分隔的层级名称从最上层开始依次应用各级的配置 eg:game.battle.skill 依次应用 game、game.battle、game.battle.skill,
+//各级的临时等级(SetLevelFor)在该级配置之后应用
+func effectiveSettings(name string) Settings {
+	s := rootSettings()
+	for _, node := range ancestors(name) {
+		if types, ok := overrides[node]; ok {
+			s.override(node, types)
+		}
+		if t, ok := tempLevels[node]; ok {
+			s.Level = t.level
+		}
+	}
+	return s
+}
+
+//ancestors 返回层级名称从最上层到自身的各级名称 eg:game.battle.skill ==> [game game.battle game.battle.skill]
+func ancestors(name string) []string {
+	nodes := make([]string, 0, strings.Count(name, ".")+1)
+	for i := 0; i < len(name); i++ {
+		if name[i] == '.' && i > 0 {
+			nodes = append(nodes, name[:i])
+		}
+	}
+	return append(nodes, name)
+}
+
+//override 在当前配置上应用输出参数,参数中包含输出方式时不再继承原有的输出方式
+func (s *Settings) override(name string, types []string) {
+	for _, arg := range types {
+		if isOutputArg(arg) {
+			s.Flag &^= Lconsole | Lfilexport
+			s.Appenders = nil
+			break
+		}
+	}
+	for _, arg := range types {
+		s.update(name, arg)
+	}
+}
+
+//isOutputArg 是否为输出方式参数
+func isOutputArg(arg string) bool {
+	arg, _ = parseFileArg(arg)
+	switch arg {
+	case "CONSOLE", "DAILY_ROLLING_FILE":
+		return true
+	}
+	_, ok := GetAppender(arg)
+	return ok
+}
+
+//update 应用一个输出参数,name 为记录器名称,全局配置时为空
+func (s *Settings) update(name string, arg string) {
+	arg, param := parseFileArg(arg)
+	switch arg {
+	case "CONSOLE":
+		s.Flag |= Lconsole
+	case "ASYNC":
+		s.Flag |= Lasync
+	case "DAILY_ROLLING_FILE":
+		rc, ok := fileSections[name]
+		if name == "" {
+			ok = false
+		}
+		if param != "" {
+			if !ok {
+				rc = dailyCfg
+			}
+			rc.FilePath = param
+			ok = true
+		}
+		if ok {
+			if w, err := openLoggerFile(rc); err != nil {
+				Warnf("logger[%s] log file path err:%s", name, err)
+			} else {
+				s.Out = w
+				s.Flag |= Lfilexport
+			}
+		} else if wc != nil {
+			s.Out = wc
+			s.Flag |= Lfilexport
+		} else {
+			Infoln("config no set out file path.eg:[daily_file] filePath=./test.daily.log")
+		}
+	case "DEBUG":
+		s.Level = LEVEL_DEBUG
+	case "INFO":
+		s.Level = LEVEL_INFO
+	case "WARN":
+		s.Level = LEVEL_WARN
+	case "ERROR":
+		s.Level = LEVEL_ERROR
+	case "FATAL":
+		s.Level = LEVEL_FATAL
+	case "DUMPSTACK":
+		s.Trace = true
+	case "SAMPLE":
+		if err := s.Sample.parseSample(param); err != nil {
+			Warnf("logger[%s] %v", name, err)
+		}
+	case "RATE":
+		if err := s.Sample.parseRate(param); err != nil {
+			Warnf("logger[%s] %v", name, err)
+		}
+	case "DEDUP":
+		if d, err := parseDedup(param); err != nil {
+			Warnf("logger[%s] %v", name, err)
+		} else {
+			s.Dedup = d
+		}
+	default:
+		if f, ok := GetFormatter(arg); ok {
+			s.Formatter = f
+		} else if a, ok := GetAppender(arg); ok {
+			s.Appenders = addAppender(s.Appenders, a)
+		}
+	}
+}
+
+//Equal 配置是否相同
+func (s Settings) Equal(o Settings) bool {
+	if s.Level != o.Level || s.Flag != o.Flag || s.Trace != o.Trace || s.Sample != o.Sample || s.Dedup != o.Dedup || !sameValue(s.Out, o.Out) || !sameValue(s.Formatter, o.Formatter) || len(s.Appenders) != len(o.Appenders) {
+		return false
+	}
+	for i, a := range s.Appenders {
+		if !sameValue(a, o.Appenders[i]) {
+			return false
+		}
+	}
+	return true
+}
+
+//sameValue 比较两个接口值,动态类型不可比较时视为不同
+func sameValue(a, b interface{}) bool {
+	if a == nil || b == nil {
+		return a == nil && b == nil
+	}
+	ta, tb := reflect.TypeOf(a), reflect.TypeOf(b)
+	return ta == tb && ta.Comparable() && a == b
+}
+
+//String 配置描述 eg:level=INFO outputs=CONSOLE,DAILY_ROLLING_FILE formatter=JSON trace=false async=false
+func (s Settings) String() string {
+	str := fmt.Sprintf("level=%s outputs=%s formatter=%s trace=%v async=%v",
+		levelNames[s.Level], strings.Join(s.Outputs(), ","), formatterName(s.Formatter), s.Trace, s.Flag&Lasync != 0)
+	if s.Sample.Enabled() {
+		str += " sample=" + s.Sample.String()
+	}
+	if s.Dedup > 0 {
+		str += " dedup=" + s.Dedup.String()
+	}
+	return str
+}
+
+//Outputs 返回输出方式名称 eg:CONSOLE DAILY_ROLLING_FILE DAILY_ROLLING_FILE(./log/test1.log) 输出目标名称
+func (s Settings) Outputs() []string {
+	var outputs []string
+	if s.Flag&Lconsole != 0 {
+		outputs = append(outputs, "CONSOLE")
+	}
+	if s.Flag&Lfilexport != 0 {
+		if isDailyWriter(s.Out) {
+			outputs = append(outputs, "DAILY_ROLLING_FILE")
+		} else if r, ok := s.Out.(*DailyRotate); ok {
+			outputs = append(outputs, "DAILY_ROLLING_FILE("+r.fdir+")")
+		} else {
+			outputs = append(outputs, fmt.Sprintf("%T", s.Out))
+		}
+	}
+	for _, a := range s.Appenders {
+		outputs = append(outputs, a.Name())
+	}
+	return outputs
+}
+
+//formatterName 返回格式化器注册的名称
+func formatterName(f Formatter) string {
+	if f == nil {
+		return "TEXT"
+	}
+	formatterMu.RLock()
+	defer formatterMu.RUnlock()
+	names := make([]string, 0, 1)
+	for name, o := range formatters {
+		if sameValue(f, o) {
+			names = append(names, name)
+		}
+	}
+	if len(names) == 0 {
+		return fmt.Sprintf("%T", f)
+	}
+	sort.Strings(names)
+	return names[0]
+}
+
+//settings 返回记录器当前配置
+func (l *Logger) settings() Settings {
+	l = l.base()
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return l.settingsLocked()
+}
+
+func (l *Logger) settingsLocked() Settings {
+	s := Settings{Level: l.Level, Flag: l.Flag, Trace: l.Trace, Out: l.Out, Formatter: l.Formatter, Appenders: l.Appenders}
+	if l.sampler != nil {
+		s.Sample = l.sampler.cfg
+	}
+	if l.dedup != nil {
+		s.Dedup = l.dedup.timeout
+	}
+	return s
+}
+
+//apply 替换记录器配置,返回旧的配置,采样、重复消息合并配置变化时替换采样器、合并器
+func (l *Logger) apply(s Settings) (old Settings) {
+	l = l.base()
+	l.mu.Lock()
+	old = l.settingsLocked()
+	if l.dedup != nil {
+		//替换输出配置前,使用旧的输出配置输出未输出的重复汇总
+		l.dedup.flush(l)
+		l.dedup = nil
+	}
+	atomic.StoreInt32((*int32)(&l.Level), int32(s.Level))
+	l.Flag, l.Trace, l.Out, l.Formatter, l.Appenders = s.Flag, s.Trace, s.Out, s.Formatter, s.Appenders
+	if s.Dedup > 0 {
+		l.dedup = &dedup{timeout: s.Dedup}
+	}
+	var stale *sampler
+	if s.Sample != old.Sample {
+		stale = l.sampler
+		l.sampler = nil
+		if s.Sample.Enabled() {
+			l.sampler = newSampler(l, s.Sample)
+		}
+	}
+	l.mu.Unlock()
+	if stale != nil {
+		//旧采样器输出剩余的汇总后停止
+		stale.close()
+	}
+	return
+}
+
+//ResetGlobalOutPut 将全局输出参数恢复为配置文件中的配置
+func ResetGlobalOutPut() {
+	mu.Lock()
+	defer mu.Unlock()
+	setRoot(configRoot)
+}
+
+//ResetOutPutByName 将记录器的输出参数恢复为配置文件中的配置
+func ResetOutPutByName(name string) {
+	mu.Lock()
+	defer mu.Unlock()
+	if logger, ok := logMap[name]; ok {
+		logger.apply(effectiveSettings(name))
+	}
+}
+
+//applyConfig 重新计算所有记录器的生效配置并应用,返回发生变化的记录器
+func applyConfig() []ConfigChange {
+	var changes []ConfigChange
+	for name, logger := range logMap {
+		s := effectiveSettings(name)
+		if old := logger.apply(s); !old.Equal(s) {
+			changes = append(changes, ConfigChange{Name: name, Old: old, New: s})
+		}
+	}
+	sort.Slice(changes, func(i, j int) bool { return changes[i].Name < changes[j].Name })
+	return changes
+}
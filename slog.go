@@ -0,0 +1,113 @@
+// Copyright 2016 zxfonline@sina.com. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+//go:build go1.21
+// +build go1.21
+
+package golog
+
+import (
+	"context"
+	"log/slog"
+	"time"
+)
+
+//SlogLevelFatal 对应 LEVEL_FATAL 的 slog 等级,slog 中高于 ERROR 的等级均输出为 FATAL(不会退出程序)
+const SlogLevelFatal = slog.LevelError + 4
+
+//SlogHandler 将 slog 记录输出到 golog 记录器的 slog.Handler,等级、输出方式、格式均使用记录器的配置,
+//属性输出为结构化字段,分组以"."连接作为字段名前缀 eg:request.id
+type SlogHandler struct {
+	l      *Logger
+	fields []Field
+	prefix string
+}
+
+//NewSlogHandler 构建输出到记录器的 slog.Handler
+//eg: slog.SetDefault(slog.New(golog.NewSlogHandler(golog.Get("game"))))
+func NewSlogHandler(l *Logger) *SlogHandler {
+	return &SlogHandler{l: l}
+}
+
+//SlogLevel 将 slog 等级转换为日志等级
+func SlogLevel(level slog.Level) LogLevel {
+	switch {
+	case level < slog.LevelInfo:
+		return LEVEL_DEBUG
+	case level < slog.LevelWarn:
+		return LEVEL_INFO
+	case level < slog.LevelError:
+		return LEVEL_WARN
+	case level < SlogLevelFatal:
+		return LEVEL_ERROR
+	default:
+		return LEVEL_FATAL
+	}
+}
+
+func (h *SlogHandler) Enabled(_ context.Context, level slog.Level) bool {
+	return SlogLevel(level) >= h.l.level()
+}
+
+//Handle 输出记录,同时携带 ctx 中通过 NewContext 添加的结构化字段
+func (h *SlogHandler) Handle(ctx context.Context, r slog.Record) error {
+	level := SlogLevel(r.Level)
+	if level < h.l.level() || h.l.sampledAt(level, 0, r.PC, r.Message) {
+		return nil
+	}
+	fields := joinFields(joinFields(h.l.fields, FromContext(ctx)), h.fields)
+	if r.NumAttrs() > 0 {
+		fields = append(fields[:len(fields):len(fields)], make([]Field, 0, r.NumAttrs())...)
+		r.Attrs(func(a slog.Attr) bool {
+			fields = appendAttr(fields, h.prefix, a)
+			return true
+		})
+	}
+	t := r.Time
+	if t.IsZero() {
+		t = time.Now()
+	}
+	h.l.outputAt(t, level, 0, r.PC, r.Message, fields)
+	return nil
+}
+
+func (h *SlogHandler) WithAttrs(attrs []slog.Attr) slog.Handler {
+	if len(attrs) == 0 {
+		return h
+	}
+	fields := h.fields[:len(h.fields):len(h.fields)]
+	for _, a := range attrs {
+		fields = appendAttr(fields, h.prefix, a)
+	}
+	return &SlogHandler{l: h.l, fields: fields, prefix: h.prefix}
+}
+
+func (h *SlogHandler) WithGroup(name string) slog.Handler {
+	if name == "" {
+		return h
+	}
+	return &SlogHandler{l: h.l, fields: h.fields, prefix: h.prefix + name + "."}
+}
+
+//appendAttr 将属性转换为结构化字段,分组属性展开为带前缀的字段,空属性及空分组被忽略
+func appendAttr(fields []Field, prefix string, a slog.Attr) []Field {
+	v := a.Value.Resolve()
+	if v.Kind() == slog.KindGroup {
+		attrs := v.Group()
+		if len(attrs) == 0 {
+			return fields
+		}
+		if a.Key != "" {
+			prefix += a.Key + "."
+		}
+		for _, ga := range attrs {
+			fields = appendAttr(fields, prefix, ga)
+		}
+		return fields
+	}
+	if a.Key == "" && v.Any() == nil {
+		return fields
+	}
+	return append(fields, Field{Key: prefix + a.Key, Value: v.Any()})
+}
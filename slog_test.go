@@ -0,0 +1,42 @@
+//go:build go1.21
+// +build go1.21
+
+package golog
+
+import (
+	"bytes"
+	"log/slog"
+	"strings"
+	"testing"
+)
+
+func TestSlogHandler(t *testing.T) {
+	var buf bytes.Buffer
+	logex := &Logger{Name: "slog", Level: LEVEL_INFO, Flag: Lshortfile | Lfilexport, Out: &buf}
+	sl := slog.New(NewSlogHandler(logex)).With("svc", "game").WithGroup("req")
+	sl.Debug("hidden")
+	sl.Warn("slow request", "id", 7, slog.Group("user", "name", "bob"))
+	out := buf.String()
+	if strings.Contains(out, "hidden") {
+		t.Fatalf("debug record not filtered:%s", out)
+	}
+	for _, s := range []string{"[WARN ]", "slog_test.go:", "slow request", "svc=game", "req.id=7", "req.user.name=bob"} {
+		if !strings.Contains(out, s) {
+			t.Fatalf("missing %q in %q", s, out)
+		}
+	}
+	buf.Reset()
+	st := Settings{Level: LEVEL_INFO, Flag: Lfilexport, Out: &buf}
+	st.update("slog", "RATE(1/1h)")
+	logex.apply(st)
+	defer logex.apply(Settings{})
+	for i := 0; i < 3; i++ {
+		sl.Warn("limited", "i", i)
+	}
+	if n := strings.Count(buf.String(), "limited"); n != 1 {
+		t.Fatalf("rate limit passed %d slog records", n)
+	}
+	if SlogLevel(SlogLevelFatal) != LEVEL_FATAL || SlogLevel(slog.LevelDebug-4) != LEVEL_DEBUG {
+		t.Fatal("slog level mapping")
+	}
+}
@@ -0,0 +1,124 @@
+// Copyright 2016 zxfonline@sina.com. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package golog
+
+import (
+	"strings"
+	"sync/atomic"
+	"time"
+
+	"github.com/zxfonline/config"
+)
+
+//tempLevel 临时的等级配置,到期后自动恢复为配置文件中的等级
+type tempLevel struct {
+	level  LogLevel
+	expire time.Time
+	timer  *time.Timer
+	config bool //是否来自配置文件[temp_level]
+}
+
+//临时等级配置,key 为记录器名称
+var tempLevels = make(map[string]*tempLevel)
+
+//SetLevelFor 临时修改记录器(包括下级记录器)的等级,d 时间后自动恢复为配置文件中的等级,
+//重新加载配置时继续生效直到到期,d<=0 时立即恢复
+//eg: golog.SetLevelFor("game.battle", golog.LEVEL_DEBUG, 10*time.Minute)
+func SetLevelFor(name string, level LogLevel, d time.Duration) {
+	mu.Lock()
+	defer mu.Unlock()
+	setTempLevel(name, level, d, false)
+	refreshLevel(name)
+}
+
+//TempLevelExpire 返回记录器临时等级的到期时间
+func TempLevelExpire(name string) (time.Time, bool) {
+	mu.Lock()
+	defer mu.Unlock()
+	if t, ok := tempLevels[name]; ok {
+		return t.expire, true
+	}
+	return time.Time{}, false
+}
+
+func setTempLevel(name string, level LogLevel, d time.Duration, config bool) {
+	if old, ok := tempLevels[name]; ok {
+		old.timer.Stop()
+		delete(tempLevels, name)
+	}
+	if d <= 0 {
+		return
+	}
+	t := &tempLevel{level: level, expire: time.Now().Add(d), config: config}
+	t.timer = time.AfterFunc(d, func() { expireTempLevel(name, t) })
+	tempLevels[name] = t
+	Infof("logger[%s] temp level:%s expire:%s", name, levelNames[level], t.expire.Format("2006-01-02 15:04:05"))
+}
+
+func expireTempLevel(name string, t *tempLevel) {
+	mu.Lock()
+	defer mu.Unlock()
+	if tempLevels[name] != t {
+		return
+	}
+	delete(tempLevels, name)
+	refreshLevel(name)
+	Infof("logger[%s] temp level expired,reset to config", name)
+}
+
+//refreshLevel 重新计算记录器及其下级记录器的等级,其余配置保持不变
+func refreshLevel(name string) {
+	for lname, logger := range logMap {
+		if lname == name || strings.HasPrefix(lname, name+".") {
+			logger.setLevel(effectiveSettings(lname).Level)
+		}
+	}
+}
+
+//setLevel 修改记录器等级
+func (l *Logger) setLevel(level LogLevel) {
+	l = l.base()
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	atomic.StoreInt32((*int32)(&l.Level), int32(level))
+}
+
+//initTempLevel 解析配置文件中的临时等级配置,过期的配置被忽略,通过 SetLevelFor 设置的临时等级优先
+//eg: [temp_level]game.battle=DEBUG,2016-06-01 12:00:00
+func initTempLevel(cfg *config.Config) {
+	for name, t := range tempLevels {
+		if t.config {
+			t.timer.Stop()
+			delete(tempLevels, name)
+		}
+	}
+	options, err := cfg.SectionOptions("temp_level")
+	if err != nil {
+		return
+	}
+	for _, name := range options {
+		v, err := cfg.String("temp_level", name)
+		if err != nil {
+			continue
+		}
+		args := strings.SplitN(v, ",", 2)
+		level, ok := parseLevel(args[0])
+		if !ok || len(args) != 2 {
+			Warnf("[temp_level] %s=%s err:invalid value,eg:DEBUG,2016-06-01 12:00:00", name, v)
+			continue
+		}
+		expire, err := time.ParseInLocation("2006-01-02 15:04:05", strings.TrimSpace(args[1]), time.Local)
+		if err != nil {
+			Warnf("[temp_level] %s=%s err:%v", name, v, err)
+			continue
+		}
+		if _, ok := tempLevels[name]; ok {
+			continue
+		}
+		if d := time.Until(expire); d > 0 {
+			setTempLevel(name, level, d, true)
+		}
+	}
+}